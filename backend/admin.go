@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cacheRefreshResponse reports a forced rebuild. On failure the version and
+// count describe the snapshot that keeps serving, if any.
+type cacheRefreshResponse struct {
+	Refreshed    bool       `json:"refreshed"`
+	Version      string     `json:"version,omitempty"`
+	DataVersion  string     `json:"data_version,omitempty"`
+	ProductCount int        `json:"product_count"`
+	BuiltAt      *time.Time `json:"built_at,omitempty"`
+	DurationMS   float64    `json:"duration_ms"`
+	Errors       []string   `json:"errors"`
+	Warnings     []string   `json:"warnings"`
+}
+
+// withAdminAuth requires "Authorization: Bearer <token>". Without a
+// configured token the admin API is disabled rather than open.
+func withAdminAuth(next http.Handler, token string) http.Handler {
+	expected := sha256.Sum256([]byte(token))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeError(w, http.StatusForbidden, "admin API is disabled; set BACKEND_ADMIN_TOKEN to enable it")
+			return
+		}
+
+		scheme, presented, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		// Comparing digests keeps the comparison constant-time regardless of
+		// the presented token's length.
+		presentedSum := sha256.Sum256([]byte(strings.TrimSpace(presented)))
+		if !ok || !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare(presentedSum[:], expected[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheRefreshHandler rebuilds the snapshot synchronously. It joins the
+// single-flight load machinery, so a refresh requested while a load is in
+// flight waits for it and then rebuilds once more.
+func cacheRefreshHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		started := time.Now()
+		snapshot, err := service.refreshSnapshot(r.Context())
+		response := cacheRefreshResponse{
+			Refreshed:  err == nil,
+			DurationMS: float64(time.Since(started).Microseconds()) / 1000,
+			Errors:     []string{},
+			Warnings:   []string{},
+		}
+		if snapshot != nil {
+			builtAt := snapshot.builtAt
+			response.Version = snapshot.version
+			response.DataVersion = snapshot.dataVersion
+			response.ProductCount = len(snapshot.products)
+			response.BuiltAt = &builtAt
+		}
+
+		status := http.StatusOK
+		if err != nil {
+			slog.ErrorContext(r.Context(), "admin cache refresh failed", "error", err)
+			response.Errors = append(response.Errors, err.Error())
+			status = http.StatusBadGateway
+		} else {
+			response.Warnings = append(response.Warnings, snapshot.warnings...)
+			slog.InfoContext(r.Context(), "admin cache refresh", "version", snapshot.version, "products", len(snapshot.products))
+		}
+		writeJSON(w, status, response)
+	})
+}
+
+func cacheInvalidateHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", http.MethodDelete)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if err := service.Invalidate(r.Context()); err != nil {
+			slog.ErrorContext(r.Context(), "admin cache invalidation failed", "error", err)
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// dataQualityHandler serves the validation report of the last source load.
+func dataQualityHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		report, ok := service.DataQualityReport()
+		if !ok {
+			writeError(w, http.StatusNotFound, "no source load has been validated yet")
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	})
+}
+
+// orphansHandler serves the IDs skipped by the last snapshot build because
+// they had no counterpart in the other sources.
+func orphansHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		report, ok := service.OrphanReport()
+		if !ok {
+			writeError(w, http.StatusNotFound, "no snapshot has been built yet")
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	})
+}
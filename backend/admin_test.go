@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "test-admin-token"
+
+func adminRequest(method, path string) *http.Request {
+	request := httptest.NewRequest(method, path, nil)
+	request.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return request
+}
+
+func decodeRefreshResponse(t *testing.T, recorder *httptest.ResponseRecorder) cacheRefreshResponse {
+	t.Helper()
+	var response cacheRefreshResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid refresh response %q: %v", recorder.Body.String(), err)
+	}
+	return response
+}
+
+func TestAdminAuth(t *testing.T) {
+	captureLogOutput(t)
+	service := NewProductService(&fakeSource{}, 30*time.Second)
+
+	disabled := buildServerHandler(service, NewMetrics(), serverConfig{})
+	recorder := httptest.NewRecorder()
+	disabled.ServeHTTP(recorder, adminRequest(http.MethodPost, "/admin/cache/refresh"))
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected admin API to be disabled without a token, got %d", recorder.Code)
+	}
+
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{AdminToken: testAdminToken})
+	for _, header := range []string{"", "Bearer wrong-token", "Basic " + testAdminToken, testAdminToken} {
+		request := httptest.NewRequest(http.MethodDelete, "/admin/cache", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("expected 401 with a challenge for Authorization %q, got %d", header, recorder.Code)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodDelete, "/admin/cache", nil)
+	request.Header.Set("Authorization", "bearer "+testAdminToken)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected case-insensitive bearer scheme to be accepted, got %d", recorder.Code)
+	}
+}
+
+func TestAdminCacheRefresh_RebuildsSynchronously(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100, ImageURL: "https://img.example/p1.jpg", Category: "phones", Brand: "acme"}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 1, Condition: "new"}},
+	}
+	popularity := &fakePopularitySource{err: errors.New("popularity down")}
+	service := NewProductService(source, time.Hour).WithPopularitySource(popularity)
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{AdminToken: testAdminToken})
+
+	first, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil || first.Total != 1 {
+		t.Fatalf("unexpected first query: total=%d err=%v", first.Total, err)
+	}
+	source.mu.Lock()
+	source.metadata = append(source.metadata, MetadataRecord{ID: "p2", Name: "Laptop", BasePrice: 900, ImageURL: "https://img.example/p2.jpg", Category: "laptops", Brand: "acme"})
+	source.details = append(source.details, DetailsRecord{ID: "p2", Stock: 2, Condition: "new"})
+	source.mu.Unlock()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodPost, "/admin/cache/refresh"))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	response := decodeRefreshResponse(t, recorder)
+	if !response.Refreshed || response.ProductCount != 2 || response.Version == "" || response.BuiltAt == nil || len(response.Errors) != 0 {
+		t.Fatalf("unexpected refresh response: %+v", response)
+	}
+	if len(response.Warnings) != 1 || !strings.Contains(response.Warnings[0], "popularity down") {
+		t.Fatalf("expected the popularity failure as a warning, got %v", response.Warnings)
+	}
+
+	second, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil || second.Total != 2 {
+		t.Fatalf("expected the refreshed snapshot to serve within the TTL, got total=%d err=%v", second.Total, err)
+	}
+	if metadataCalls, _ := source.callCounts(); metadataCalls != 2 {
+		t.Fatalf("expected exactly one rebuild for the refresh, metadataCalls=%d", metadataCalls)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/cache/refresh"))
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("expected 405 allowing POST, got %d", recorder.Code)
+	}
+}
+
+func TestAdminCacheRefresh_ReportsLoadErrorsAndServingSnapshot(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	service := NewProductService(source, time.Hour)
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{AdminToken: testAdminToken})
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	version := service.cached.version
+
+	source.setErr(errors.New("metadata upstream down"))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodPost, "/admin/cache/refresh"))
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", recorder.Code)
+	}
+	response := decodeRefreshResponse(t, recorder)
+	if response.Refreshed || response.Version != version || response.ProductCount != 1 {
+		t.Fatalf("expected the still-serving snapshot in the response, got %+v", response)
+	}
+	if len(response.Errors) != 1 || !strings.Contains(response.Errors[0], "load metadata: metadata upstream down") {
+		t.Fatalf("expected the load error, got %v", response.Errors)
+	}
+}
+
+func TestAdminCacheRefresh_WaitsForInFlightLoad(t *testing.T) {
+	captureLogOutput(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	source.setMetadataBarrier(started, release)
+	service := NewProductService(source, time.Hour)
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{AdminToken: testAdminToken})
+
+	go func() { _, _ = service.QueryProducts(context.Background(), ProductQuery{}) }()
+	<-started
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, adminRequest(http.MethodPost, "/admin/cache/refresh"))
+		done <- recorder
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected refresh to wait for the in-flight load")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	recorder := <-done
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	if metadataCalls, _ := source.callCounts(); metadataCalls != 2 {
+		t.Fatalf("expected the in-flight load plus one forced rebuild, metadataCalls=%d", metadataCalls)
+	}
+}
+
+func TestAdminCacheInvalidate_DropsLocalAndSharedSnapshot(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	shared := NewMemorySnapshotCache()
+	service := NewProductService(source, time.Hour).WithSnapshotCache(shared)
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{AdminToken: testAdminToken})
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodDelete, "/admin/cache"))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", recorder.Code)
+	}
+	if _, ok := service.CacheState(); ok {
+		t.Fatal("expected no local snapshot after invalidation")
+	}
+	if entry, _ := shared.Load(context.Background()); entry != nil {
+		t.Fatal("expected the shared entry to be deleted")
+	}
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metadataCalls, _ := source.callCounts(); metadataCalls != 2 {
+		t.Fatalf("expected the next request to rebuild from the sources, metadataCalls=%d", metadataCalls)
+	}
+}
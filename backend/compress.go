@@ -0,0 +1,218 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+
+	// brotliLevel trades ratio for speed; responses are compressed per
+	// request, where the highest levels cost more than they save.
+	brotliLevel = 5
+)
+
+// supportedEncodings is in order of preference when a client accepts
+// several with the same q-value.
+var supportedEncodings = []string{encodingBrotli, encodingGzip}
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, brotliLevel) }}
+)
+
+// resettableWriter is implemented by both pooled encoders.
+type resettableWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+// negotiateEncoding picks the supported encoding with the highest q-value
+// in an Accept-Encoding header, or "" for an uncompressed response.
+func negotiateEncoding(header string) string {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(key)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			weight = parsed
+		}
+		weights[name] = weight
+	}
+
+	best, bestWeight := "", 0.0
+	for _, encoding := range supportedEncodings {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight = weights["*"]
+		}
+		if weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+	return best
+}
+
+// withCompression compresses responses of at least minSize bytes with the
+// encoding negotiated from Accept-Encoding. Smaller bodies, such as error
+// responses, and bodiless responses such as 304 are sent as they are.
+func withCompression(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// compressWriter buffers the start of the body until it knows whether the
+// response reaches the minimum size, then commits the headers and either
+// streams through an encoder or writes through unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	committed   bool
+	buffer      []byte
+	encoder     resettableWriter
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	if !bodyAllowed(status) {
+		_ = w.commit(false)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.committed {
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < w.minSize {
+			return len(data), nil
+		}
+		if err := w.commit(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// commit sends the headers and the buffered body. compress reports whether
+// the body reached the minimum size.
+func (w *compressWriter) commit(compress bool) error {
+	w.committed = true
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" && compressibleType(header.Get("Content-Type")) {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		// The compressed bytes differ from the identity representation, so
+		// a strong validator no longer holds.
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.encoder = acquireEncoder(w.encoding, w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buffered := w.buffer
+	w.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buffered)
+	} else {
+		_, err = w.ResponseWriter.Write(buffered)
+	}
+	return err
+}
+
+// close flushes a body that stayed below the minimum size and finishes the
+// compressed stream. Write errors mean the client went away, and the
+// handler has returned, so there is nobody left to report them to.
+func (w *compressWriter) close() {
+	if !w.committed && w.wroteHeader {
+		_ = w.commit(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		releaseEncoder(w.encoding, w.encoder)
+		w.encoder = nil
+	}
+}
+
+func acquireEncoder(encoding string, destination io.Writer) resettableWriter {
+	var encoder resettableWriter
+	if encoding == encodingBrotli {
+		encoder = brotliWriters.Get().(*brotli.Writer)
+	} else {
+		encoder = gzipWriters.Get().(*gzip.Writer)
+	}
+	encoder.Reset(destination)
+	return encoder
+}
+
+func releaseEncoder(encoding string, encoder resettableWriter) {
+	encoder.Reset(io.Discard)
+	if encoding == encodingBrotli {
+		brotliWriters.Put(encoder)
+	} else {
+		gzipWriters.Put(encoder)
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressibleType limits compression to text formats; the API only serves
+// JSON and text, but already compressed types would only grow.
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
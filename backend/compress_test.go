@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                           "",
+		"identity":                   "",
+		"gzip":                       "gzip",
+		"gzip, deflate, br":          "br",
+		"br;q=0.5, gzip":             "gzip",
+		"BR;Q=1, GZIP;q=1":           "br",
+		"br;q=0, gzip;q=0":           "",
+		"*":                          "br",
+		"*;q=0.1, gzip;q=0.5":        "gzip",
+		"gzip;q=0, *;q=0.3":          "br",
+		"deflate, gzip;q=not-number": "",
+	} {
+		if got := negotiateEncoding(header); got != want {
+			t.Fatalf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func newCompressionTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+	captureLogOutput(t)
+	source := &fakeSource{}
+	for i := 0; i < 30; i++ {
+		id := fmt.Sprintf("p%02d", i)
+		source.metadata = append(source.metadata, MetadataRecord{ID: id, Name: "Phone " + id, BasePrice: 100, ImageURL: "https://img.example/" + id + ".jpg", Category: "phones", Brand: "acme"})
+		source.details = append(source.details, DetailsRecord{ID: id, Stock: 1, Condition: "new"})
+	}
+	service := NewProductService(source, 30*time.Second)
+	return buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*", Compression: true, CompressionMinBytes: DefaultCompressionMinBytes})
+}
+
+func serveWithEncoding(handler http.Handler, target, acceptEncoding string, headers ...string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCompression_NegotiatesAndRoundTrips(t *testing.T) {
+	handler := newCompressionTestHandler(t)
+	plain := serveWithEncoding(handler, "/products?limit=30", "")
+	if plain.Code != http.StatusOK || plain.Header().Get("Content-Encoding") != "" || plain.Body.Len() < DefaultCompressionMinBytes {
+		t.Fatalf("expected a large uncompressed body without Accept-Encoding, got %d %q (%d bytes)", plain.Code, plain.Header().Get("Content-Encoding"), plain.Body.Len())
+	}
+	if !strings.Contains(plain.Header().Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("expected Vary: Accept-Encoding on uncompressed responses too, got %v", plain.Header().Values("Vary"))
+	}
+
+	for encoding, decode := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	} {
+		recorder := serveWithEncoding(handler, "/products?limit=30", encoding)
+		if recorder.Header().Get("Content-Encoding") != encoding || recorder.Body.Len() >= plain.Body.Len() {
+			t.Fatalf("expected a smaller %s body, got %q with %d bytes", encoding, recorder.Header().Get("Content-Encoding"), recorder.Body.Len())
+		}
+		reader, err := decode(recorder.Body)
+		if err != nil {
+			t.Fatalf("invalid %s stream: %v", encoding, err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(decoded, plain.Body.Bytes()) {
+			t.Fatalf("expected %s body to decode to the plain body (err=%v)", encoding, err)
+		}
+	}
+}
+
+func TestCompression_SkipsSmallErrorAndNotModifiedResponses(t *testing.T) {
+	handler := newCompressionTestHandler(t)
+
+	badRequest := serveWithEncoding(handler, "/products?limit=abc", "gzip, br")
+	if badRequest.Code != http.StatusBadRequest || badRequest.Header().Get("Content-Encoding") != "" || !strings.Contains(badRequest.Body.String(), `"error"`) {
+		t.Fatalf("expected a plain error body, got %d %q %q", badRequest.Code, badRequest.Header().Get("Content-Encoding"), badRequest.Body.String())
+	}
+	if health := serveWithEncoding(handler, "/health", "gzip"); health.Header().Get("Content-Encoding") != "" || health.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Fatalf("expected a small body below the threshold to stay plain, got %q", health.Body.String())
+	}
+
+	product := serveWithEncoding(handler, "/products/p01", "gzip")
+	etag := product.Header().Get("ETag")
+	if product.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected product with ETag, got %d", product.Code)
+	}
+	notModified := serveWithEncoding(handler, "/products/p01", "gzip", "If-None-Match", etag)
+	if notModified.Code != http.StatusNotModified || notModified.Header().Get("Content-Encoding") != "" || notModified.Body.Len() != 0 {
+		t.Fatalf("expected a bare 304, got %d %q (%d bytes)", notModified.Code, notModified.Header().Get("Content-Encoding"), notModified.Body.Len())
+	}
+}
+
+func TestCompressWriter_WeakensETagAndStreamsAfterThreshold(t *testing.T) {
+	payload := strings.Repeat(`{"id":"p1"}`, 200)
+	handler := withCompression(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		for i := 0; i < len(payload); i += 100 {
+			_, _ = io.WriteString(w, payload[i:min(i+100, len(payload))])
+		}
+	}), 512)
+
+	recorder := serveWithEncoding(handler, "/", "gzip")
+	if recorder.Header().Get("ETag") != `W/"abc"` || recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a weak ETag on a compressed body, got %v", recorder.Header())
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip stream: %v", err)
+	}
+	if decoded, err := io.ReadAll(reader); err != nil || string(decoded) != payload {
+		t.Fatalf("expected chunked writes to decode in order (err=%v)", err)
+	}
+
+	image := withCompression(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = io.WriteString(w, payload)
+	}), 0)
+	if recorder := serveWithEncoding(image, "/", "gzip"); recorder.Header().Get("Content-Encoding") != "" || recorder.Body.String() != payload {
+		t.Fatal("expected non-text content types to pass through")
+	}
+}
@@ -1,34 +1,391 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 type serverConfig struct {
-	Host            string
-	Port            int
-	DataDir         string
-	CacheTTL        time.Duration
-	CORSAllowOrigin string
+	Host          string
+	Port          int
+	DataDir       string
+	CacheTTL      time.Duration
+	CacheMaxStale time.Duration
+	// MetadataRefresh, DetailsRefresh, PopularityRefresh and OffersRefresh
+	// are how often each source is reloaded. Zero uses CacheTTL.
+	MetadataRefresh   time.Duration
+	DetailsRefresh    time.Duration
+	PopularityRefresh time.Duration
+	OffersRefresh     time.Duration
+	DataPoll          time.Duration
+	CORSAllowOrigin   string
+	CursorSecret      string
+	AdminToken        string
+	RedisURL          string
+	LogLevel          slog.Level
+	TracingExporter   string
+	SourceBaseURL     string
+	PopularityBaseURL string
+	OffersBaseURL     string
+	SourceTimeout     time.Duration
+	SourceRetries     int
+	// ValidationPolicies overrides validation rule policies, as
+	// "rule=policy,rule=policy".
+	ValidationPolicies string
+	// Warmup loads the first snapshot at startup instead of on the first
+	// request; /health/ready stays 503 until a snapshot is loaded.
+	Warmup bool
+	// RateLimits maps mux patterns, or "*" for the rest, to token buckets.
+	// Empty disables rate limiting.
+	RateLimits map[string]rateLimitRule
+	// TrustedProxies may set X-Forwarded-For for rate limiting.
+	TrustedProxies []netip.Prefix
+	// RateLimitAPIKeys get their own buckets instead of their client IP's.
+	RateLimitAPIKeys []string
+	// Compression enables gzip/br responses of at least
+	// CompressionMinBytes.
+	Compression         bool
+	CompressionMinBytes int
+	// BestOfferPolicy picks the offer behind a product's headline price,
+	// stock and condition.
+	BestOfferPolicy BestOfferPolicy
+	// PriceHistoryFile persists observed prices across restarts. Empty
+	// keeps the history in memory only.
+	PriceHistoryFile string
+	// SnapshotFile keeps the last loaded snapshot for warm starts while the
+	// sources are down. Empty disables it.
+	SnapshotFile string
+	// CatalogVersions is how many catalog versions are kept for rollback.
+	CatalogVersions int
 }
 
-func loadServerConfig() serverConfig {
-	cacheTTLSeconds := envInt("BACKEND_CACHE_TTL_SECONDS", DefaultCacheTTLSeconds)
-	if cacheTTLSeconds <= 0 {
-		cacheTTLSeconds = DefaultCacheTTLSeconds
-	}
+const (
+	configFileEnv = "BACKEND_CONFIG_FILE"
+	envPrefix     = "BACKEND_"
+	redactedValue = "[REDACTED]"
+)
+
+// configSetting is one configuration key. It is read from the config file
+// under key and from the environment as BACKEND_<KEY>, which wins.
+type configSetting struct {
+	key    string
+	secret bool
+	set    func(c *serverConfig, raw string) error
+	get    func(c serverConfig) any
+}
+
+func (s configSetting) envName() string {
+	return envPrefix + strings.ToUpper(s.key)
+}
+
+var configSettings = []configSetting{
+	{key: "host", set: func(c *serverConfig, raw string) error { c.Host = raw; return nil }, get: func(c serverConfig) any { return c.Host }},
+	{key: "port", set: func(c *serverConfig, raw string) error {
+		return setInt(&c.Port, raw, 1, 65535)
+	}, get: func(c serverConfig) any { return c.Port }},
+	{key: "data_dir", set: func(c *serverConfig, raw string) error { c.DataDir = raw; return nil }, get: func(c serverConfig) any { return c.DataDir }},
+	{key: "cache_ttl_seconds", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.CacheTTL, raw, time.Second, 1)
+	}, get: func(c serverConfig) any { return int(c.CacheTTL / time.Second) }},
+	{key: "cache_max_stale_seconds", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.CacheMaxStale, raw, time.Second, 0)
+	}, get: func(c serverConfig) any { return int(c.CacheMaxStale / time.Second) }},
+	{key: "metadata_refresh_seconds", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.MetadataRefresh, raw, time.Second, 0)
+	}, get: func(c serverConfig) any { return int(c.MetadataRefresh / time.Second) }},
+	{key: "details_refresh_seconds", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.DetailsRefresh, raw, time.Second, 0)
+	}, get: func(c serverConfig) any { return int(c.DetailsRefresh / time.Second) }},
+	{key: "popularity_refresh_seconds", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.PopularityRefresh, raw, time.Second, 0)
+	}, get: func(c serverConfig) any { return int(c.PopularityRefresh / time.Second) }},
+	{key: "offers_refresh_seconds", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.OffersRefresh, raw, time.Second, 0)
+	}, get: func(c serverConfig) any { return int(c.OffersRefresh / time.Second) }},
+	{key: "data_poll_seconds", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.DataPoll, raw, time.Second, 1)
+	}, get: func(c serverConfig) any { return int(c.DataPoll / time.Second) }},
+	{key: "cors_allow_origin", set: func(c *serverConfig, raw string) error { c.CORSAllowOrigin = raw; return nil }, get: func(c serverConfig) any { return c.CORSAllowOrigin }},
+	{key: "cursor_secret", secret: true, set: func(c *serverConfig, raw string) error { c.CursorSecret = raw; return nil }, get: func(c serverConfig) any { return c.CursorSecret }},
+	{key: "admin_token", secret: true, set: func(c *serverConfig, raw string) error { c.AdminToken = raw; return nil }, get: func(c serverConfig) any { return c.AdminToken }},
+	{key: "redis_url", set: func(c *serverConfig, raw string) error {
+		if _, err := NewRedisSnapshotCache(raw); err != nil {
+			return err
+		}
+		c.RedisURL = raw
+		return nil
+	}, get: func(c serverConfig) any { return redactURLPassword(c.RedisURL) }},
+	{key: "log_level", set: func(c *serverConfig, raw string) error {
+		level, err := parseLogLevel(raw)
+		if err != nil {
+			return err
+		}
+		c.LogLevel = level
+		return nil
+	}, get: func(c serverConfig) any { return strings.ToLower(c.LogLevel.String()) }},
+	{key: "tracing_exporter", set: func(c *serverConfig, raw string) error {
+		switch exporter := strings.ToLower(raw); exporter {
+		case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+			c.TracingExporter = exporter
+			return nil
+		}
+		return fmt.Errorf("unsupported tracing exporter %q (want none, stdout or otlp)", raw)
+	}, get: func(c serverConfig) any { return c.TracingExporter }},
+	{key: "source_base_url", set: func(c *serverConfig, raw string) error {
+		return setHTTPURL(&c.SourceBaseURL, raw)
+	}, get: func(c serverConfig) any { return c.SourceBaseURL }},
+	{key: "popularity_base_url", set: func(c *serverConfig, raw string) error {
+		return setHTTPURL(&c.PopularityBaseURL, raw)
+	}, get: func(c serverConfig) any { return c.PopularityBaseURL }},
+	{key: "offers_base_url", set: func(c *serverConfig, raw string) error {
+		return setHTTPURL(&c.OffersBaseURL, raw)
+	}, get: func(c serverConfig) any { return c.OffersBaseURL }},
+	{key: "best_offer_policy", set: func(c *serverConfig, raw string) (err error) {
+		c.BestOfferPolicy, err = parseBestOfferPolicy(raw)
+		return err
+	}, get: func(c serverConfig) any { return string(c.BestOfferPolicy) }},
+	{key: "source_timeout_ms", set: func(c *serverConfig, raw string) error {
+		return setDuration(&c.SourceTimeout, raw, time.Millisecond, 1)
+	}, get: func(c serverConfig) any { return int(c.SourceTimeout / time.Millisecond) }},
+	{key: "source_retries", set: func(c *serverConfig, raw string) error {
+		return setInt(&c.SourceRetries, raw, 0, 100)
+	}, get: func(c serverConfig) any { return c.SourceRetries }},
+	{key: "validation_policies", set: func(c *serverConfig, raw string) error {
+		if _, err := parseValidationPolicies(raw); err != nil {
+			return err
+		}
+		c.ValidationPolicies = raw
+		return nil
+	}, get: func(c serverConfig) any { return c.ValidationPolicies }},
+	{key: "warmup", set: func(c *serverConfig, raw string) error {
+		return setBool(&c.Warmup, raw)
+	}, get: func(c serverConfig) any { return c.Warmup }},
+	{key: "compression", set: func(c *serverConfig, raw string) error {
+		return setBool(&c.Compression, raw)
+	}, get: func(c serverConfig) any { return c.Compression }},
+	{key: "compression_min_bytes", set: func(c *serverConfig, raw string) error {
+		return setInt(&c.CompressionMinBytes, raw, 0, 1<<20)
+	}, get: func(c serverConfig) any { return c.CompressionMinBytes }},
+	{key: "price_history_file", set: func(c *serverConfig, raw string) error { c.PriceHistoryFile = raw; return nil }, get: func(c serverConfig) any { return c.PriceHistoryFile }},
+	{key: "catalog_versions", set: func(c *serverConfig, raw string) error {
+		return setInt(&c.CatalogVersions, raw, 1, 100)
+	}, get: func(c serverConfig) any { return c.CatalogVersions }},
+	{key: "snapshot_file", set: func(c *serverConfig, raw string) error { c.SnapshotFile = raw; return nil }, get: func(c serverConfig) any { return c.SnapshotFile }},
+	{key: "rate_limits", set: func(c *serverConfig, raw string) (err error) {
+		c.RateLimits, err = parseRateLimits(raw)
+		return err
+	}, get: func(c serverConfig) any { return formatRateLimits(c.RateLimits) }},
+	{key: "trusted_proxies", set: func(c *serverConfig, raw string) (err error) {
+		c.TrustedProxies, err = parseTrustedProxies(raw)
+		return err
+	}, get: func(c serverConfig) any { return formatTrustedProxies(c.TrustedProxies) }},
+	{key: "rate_limit_api_keys", secret: true, set: func(c *serverConfig, raw string) error {
+		c.RateLimitAPIKeys = splitList(raw)
+		return nil
+	}, get: func(c serverConfig) any { return strings.Join(c.RateLimitAPIKeys, ",") }},
+}
 
+func defaultServerConfig() serverConfig {
 	return serverConfig{
-		Host:            envString("BACKEND_HOST", DefaultBackendHost),
-		Port:            envInt("BACKEND_PORT", DefaultBackendPort),
-		DataDir:         envString("BACKEND_DATA_DIR", DefaultBackendDataDir),
-		CacheTTL:        time.Duration(cacheTTLSeconds) * time.Second,
-		CORSAllowOrigin: envString("BACKEND_CORS_ALLOW_ORIGIN", DefaultCORSAllowOrigin),
+		Host:                DefaultBackendHost,
+		Port:                DefaultBackendPort,
+		DataDir:             DefaultBackendDataDir,
+		CacheTTL:            DefaultCacheTTLDuration,
+		CacheMaxStale:       DefaultCacheMaxStaleDuration,
+		DataPoll:            DefaultDataPollInterval,
+		CORSAllowOrigin:     DefaultCORSAllowOrigin,
+		LogLevel:            slog.LevelInfo,
+		TracingExporter:     TracingExporterNone,
+		SourceTimeout:       DefaultSourceTimeout,
+		SourceRetries:       DefaultSourceRetries,
+		Warmup:              true,
+		Compression:         true,
+		CompressionMinBytes: DefaultCompressionMinBytes,
+		BestOfferPolicy:     DefaultBestOfferPolicy,
+		CatalogVersions:     DefaultCatalogVersions,
+	}
+}
+
+// loadServerConfig layers the defaults, the optional BACKEND_CONFIG_FILE
+// (YAML or JSON) and the environment. Every invalid or unknown key is
+// reported, joined into one error.
+func loadServerConfig() (serverConfig, error) {
+	config := defaultServerConfig()
+	var errs []error
+
+	values := make(map[string]string)
+	origins := make(map[string]string)
+	if path := strings.TrimSpace(os.Getenv(configFileEnv)); path != "" {
+		fileValues, err := readConfigFile(path)
+		if err != nil {
+			return serverConfig{}, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+			origins[key] = filepath.Base(path)
+		}
+		for _, key := range sortedKeys(fileValues) {
+			if !isConfigKey(key) {
+				errs = append(errs, fmt.Errorf("%s (%s): unknown key", key, filepath.Base(path)))
+			}
+		}
+	}
+	for _, setting := range configSettings {
+		if value := strings.TrimSpace(os.Getenv(setting.envName())); value != "" {
+			values[setting.key] = value
+			origins[setting.key] = setting.envName()
+		}
+	}
+
+	for _, setting := range configSettings {
+		raw, ok := values[setting.key]
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setting.set(&config, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", setting.key, origins[setting.key], err))
+		}
+	}
+	// A per-process cursor key breaks pagination as soon as a request lands
+	// on another replica sharing the snapshot cache.
+	if config.RedisURL != "" && config.CursorSecret == "" {
+		errs = append(errs, fmt.Errorf("cursor_secret (%sCURSOR_SECRET): required when redis_url is set, so cursors work on every replica", envPrefix))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return serverConfig{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	if config.CacheMaxStale < config.CacheTTL {
+		config.CacheMaxStale = config.CacheTTL
+	}
+	if config.PopularityBaseURL == "" {
+		config.PopularityBaseURL = config.SourceBaseURL
+	}
+	if config.OffersBaseURL == "" {
+		config.OffersBaseURL = config.SourceBaseURL
+	}
+	return config, nil
+}
+
+// readConfigFile returns the file's top-level scalars as strings. YAML is a
+// superset of JSON, so one decoder reads both.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var document map[string]any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(document))
+	var errs []error
+	for _, key := range sortedKeys(document) {
+		switch value := document[key].(type) {
+		case nil:
+			values[key] = ""
+		case map[string]any, []any:
+			errs = append(errs, fmt.Errorf("%s (%s): must be a scalar value", key, filepath.Base(path)))
+		default:
+			values[key] = strings.TrimSpace(fmt.Sprint(value))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return values, nil
+}
+
+func isConfigKey(key string) bool {
+	for _, setting := range configSettings {
+		if setting.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// redacted returns the effective configuration keyed like the config file,
+// with secrets replaced so it can be printed or logged.
+func (c serverConfig) redacted() map[string]any {
+	values := make(map[string]any, len(configSettings))
+	for _, setting := range configSettings {
+		value := setting.get(c)
+		if setting.secret && value != "" {
+			value = redactedValue
+		}
+		values[setting.key] = value
+	}
+	return values
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func setBool(target *bool, raw string) error {
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", raw)
+	}
+	*target = value
+	return nil
+}
+
+func setInt(target *int, raw string, min, max int) error {
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", raw)
+	}
+	if value < min || value > max {
+		return fmt.Errorf("%d is out of range [%d, %d]", value, min, max)
+	}
+	*target = value
+	return nil
+}
+
+func setDuration(target *time.Duration, raw string, unit time.Duration, min int) error {
+	var value int
+	if err := setInt(&value, raw, min, int(24*time.Hour/unit)); err != nil {
+		return err
 	}
+	*target = time.Duration(value) * unit
+	return nil
+}
+
+func setHTTPURL(target *string, raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid URL %q (want an absolute http or https URL)", raw)
+	}
+	*target = raw
+	return nil
+}
+
+func redactURLPassword(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return parsed.Redacted()
 }
 
 func (c serverConfig) Address() string {
@@ -58,25 +415,3 @@ func (c serverConfig) LogAddress() string {
 
 	return net.JoinHostPort(host, strconv.Itoa(port))
 }
-
-func envString(key, fallback string) string {
-	value := strings.TrimSpace(os.Getenv(key))
-	if value == "" {
-		return fallback
-	}
-	return value
-}
-
-func envInt(key string, fallback int) int {
-	value := strings.TrimSpace(os.Getenv(key))
-	if value == "" {
-		return fallback
-	}
-
-	parsed, err := strconv.Atoi(value)
-	if err != nil {
-		return fallback
-	}
-
-	return parsed
-}
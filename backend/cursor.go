@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type productCursor struct {
+	Query          string  `json:"q"`
+	ID             string  `json:"i"`
+	Name           string  `json:"n,omitempty"`
+	Price          float64 `json:"p,omitempty"`
+	PopularityRank int     `json:"r,omitempty"`
+	Relevance      float64 `json:"s,omitempty"`
+	Position       int     `json:"o"`
+}
+
+type cursorCodec struct {
+	secret []byte
+}
+
+func newCursorCodec(secret []byte) cursorCodec {
+	if len(secret) == 0 {
+		secret = randomCursorSecret()
+	}
+	return cursorCodec{secret: secret}
+}
+
+func randomCursorSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		sum := sha256.Sum256([]byte(time.Now().String()))
+		return sum[:]
+	}
+	return secret
+}
+
+func (c cursorCodec) encode(cursor productCursor) string {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(c.sign(encodedPayload))
+}
+
+func (c cursorCodec) decode(raw string) (productCursor, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(strings.TrimSpace(raw), ".")
+	if !ok || encodedPayload == "" || encodedSignature == "" {
+		return productCursor{}, fmt.Errorf("%w: malformed value", errInvalidCursor)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, c.sign(encodedPayload)) {
+		return productCursor{}, fmt.Errorf("%w: signature mismatch", errInvalidCursor)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return productCursor{}, fmt.Errorf("%w: malformed value", errInvalidCursor)
+	}
+
+	var cursor productCursor
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.ID == "" {
+		return productCursor{}, fmt.Errorf("%w: malformed value", errInvalidCursor)
+	}
+	return cursor, nil
+}
+
+func (c cursorCodec) sign(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+func cursorForProduct(product Product, position int, query ProductQuery) productCursor {
+	return productCursor{
+		Query:          queryFingerprint(query),
+		ID:             product.ID,
+		Name:           product.Name,
+		Price:          product.Price,
+		PopularityRank: product.PopularityRank,
+		Relevance:      product.relevance,
+		Position:       position,
+	}
+}
+
+// resumeIndex returns the index of the first product that sorts after the
+// cursor. With an explicit sort the cursor's key tuple is located by binary
+// search, so products added or removed before it do not shift the page.
+// Without one the listing follows source order, so the cursor resumes after
+// its ID, or near its previous position when that product is gone.
+func resumeIndex(products []Product, cursor productCursor, sortModes []string) int {
+	if len(sortModes) > 0 {
+		anchor := Product{
+			ID:             cursor.ID,
+			Name:           cursor.Name,
+			Price:          cursor.Price,
+			PopularityRank: cursor.PopularityRank,
+			relevance:      cursor.Relevance,
+		}
+		index, found := slices.BinarySearchFunc(products, anchor, productComparator(sortModes))
+		if found {
+			return index + 1
+		}
+		return index
+	}
+
+	for i, product := range products {
+		if product.ID == cursor.ID {
+			return i + 1
+		}
+	}
+	return min(max(0, cursor.Position), len(products))
+}
+
+func queryFingerprint(query ProductQuery) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "search=%s\n", strings.ToLower(strings.TrimSpace(query.Search)))
+	fmt.Fprintf(hash, "color=%s\n", fingerprintTokens(query.Colors))
+	fmt.Fprintf(hash, "category=%s\n", fingerprintTokens(query.Categories))
+	fmt.Fprintf(hash, "brand=%s\n", fingerprintTokens(query.Brands))
+	fmt.Fprintf(hash, "condition=%s\n", fingerprintTokens(query.Conditions))
+	fmt.Fprintf(hash, "sort=%s\n", strings.Join(parseSortModes(query.Sort), ","))
+	fmt.Fprintf(hash, "bestseller=%s\n", fingerprintBool(query.Bestseller))
+	fmt.Fprintf(hash, "inStock=%s\n", fingerprintBool(query.InStock))
+	fmt.Fprintf(hash, "onSale=%s\n", fingerprintBool(query.OnSale))
+	fmt.Fprintf(hash, "minPrice=%s\n", fingerprintFloat(query.MinPrice))
+	fmt.Fprintf(hash, "maxPrice=%s\n", fingerprintFloat(query.MaxPrice))
+	if query.MinStock != nil {
+		fmt.Fprintf(hash, "minStock=%d\n", *query.MinStock)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:12])
+}
+
+func fingerprintTokens(values []string) string {
+	tokens := make([]string, 0, len(values))
+	for value := range normalizedTokenSet(values) {
+		tokens = append(tokens, value)
+	}
+	slices.Sort(tokens)
+	return strings.Join(tokens, ",")
+}
+
+func fingerprintBool(value *bool) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*value)
+}
+
+func fingerprintFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCursorCodec_RoundTrip(t *testing.T) {
+	codec := newCursorCodec([]byte("secret"))
+	want := productCursor{Query: "fingerprint", ID: "p7", Name: "Phone", Price: 199.99, PopularityRank: 3, Position: 11}
+
+	got, err := codec.decode(codec.encode(want))
+	if err != nil {
+		t.Fatalf("decode() unexpected error: %v", err)
+	}
+	if got != want {
+		t.Fatalf("expected round-tripped cursor %+v, got %+v", want, got)
+	}
+}
+
+func TestCursorCodec_RejectsTamperedOrForeignCursor(t *testing.T) {
+	codec := newCursorCodec([]byte("secret"))
+	encoded := codec.encode(productCursor{Query: "fingerprint", ID: "p1"})
+
+	tests := []struct {
+		name  string
+		codec cursorCodec
+		raw   string
+	}{
+		{name: "malformed", codec: codec, raw: "not-a-cursor"},
+		{name: "tampered payload", codec: codec, raw: "x" + encoded},
+		{name: "tampered signature", codec: codec, raw: encoded + "x"},
+		{name: "different secret", codec: newCursorCodec([]byte("other-secret")), raw: encoded},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.codec.decode(tc.raw); !errors.Is(err, errInvalidCursor) {
+				t.Fatalf("expected errInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryFingerprint_IgnoresPaginationAndTokenOrder(t *testing.T) {
+	base := queryFingerprint(ProductQuery{Brands: []string{"apple", "samsung"}, Sort: "price_asc", Limit: 6, Offset: 0})
+	reordered := queryFingerprint(ProductQuery{Brands: []string{"Samsung", "apple"}, Sort: "price_asc", Limit: 12, Offset: 24})
+	if base != reordered {
+		t.Fatalf("expected fingerprint to ignore pagination and token order, got %q vs %q", base, reordered)
+	}
+
+	resorted := queryFingerprint(ProductQuery{Brands: []string{"apple", "samsung"}, Sort: "price_desc"})
+	if base == resorted {
+		t.Fatalf("expected fingerprint to change with sort")
+	}
+}
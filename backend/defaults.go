@@ -3,10 +3,25 @@ package main
 import "time"
 
 const (
-	DefaultBackendHost      = "0.0.0.0"
-	DefaultBackendPort      = 8080
-	DefaultBackendDataDir   = "data"
-	DefaultCORSAllowOrigin  = "*"
-	DefaultCacheTTLSeconds  = 30
-	DefaultCacheTTLDuration = 30 * time.Second
+	DefaultBackendHost           = "0.0.0.0"
+	DefaultBackendPort           = 8080
+	DefaultBackendDataDir        = "data"
+	DefaultCORSAllowOrigin       = "*"
+	DefaultCacheTTLSeconds       = 30
+	DefaultCacheTTLDuration      = 30 * time.Second
+	DefaultCacheMaxStaleSeconds  = 300
+	DefaultCacheMaxStaleDuration = 300 * time.Second
+	DefaultDataPollSeconds       = 2
+	DefaultDataPollInterval      = 2 * time.Second
+
+	DefaultSourceTimeoutMillis    = 2000
+	DefaultSourceTimeout          = 2 * time.Second
+	DefaultSourceRetries          = 2
+	DefaultSourceRetryBaseDelay   = 100 * time.Millisecond
+	DefaultSourceRetryMaxDelay    = 2 * time.Second
+	DefaultSourceBreakerThreshold = 5
+	DefaultSourceBreakerCooldown  = 30 * time.Second
+
+	DefaultCompressionMinBytes = 1024
+	DefaultCatalogVersions     = 5
 )
@@ -0,0 +1,155 @@
+package main
+
+import "slices"
+
+const (
+	facetColor      = "color"
+	facetBrand      = "brand"
+	facetCategory   = "category"
+	facetCondition  = "condition"
+	facetBestseller = "bestseller"
+	facetOnSale     = "onSale"
+)
+
+type facetUniverse struct {
+	colors     []string
+	brands     []string
+	categories []string
+	conditions []string
+}
+
+func buildFacetUniverse(products []Product) facetUniverse {
+	colors := make(map[string]struct{})
+	brands := make(map[string]struct{})
+	categories := make(map[string]struct{})
+	conditions := make(map[string]struct{})
+
+	for _, product := range products {
+		for _, color := range product.Colors {
+			addFacetValue(colors, color)
+		}
+		addFacetValue(brands, product.Brand)
+		addFacetValue(categories, product.Category)
+		addFacetValue(conditions, product.Condition)
+	}
+
+	return facetUniverse{
+		colors:     sortedFacetValues(colors),
+		brands:     sortedFacetValues(brands),
+		categories: sortedFacetValues(categories),
+		conditions: sortedFacetValues(conditions),
+	}
+}
+
+func addFacetValue(values map[string]struct{}, raw string) {
+	normalized := normalizeToken(raw)
+	if normalized == "" {
+		return
+	}
+	values[normalized] = struct{}{}
+}
+
+func sortedFacetValues(values map[string]struct{}) []string {
+	out := make([]string, 0, len(values))
+	for value := range values {
+		out = append(out, value)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// computeFacets counts matching products per facet value. Each facet is
+// evaluated with every active filter except its own, so selecting another
+// value of the same facet shows how many results it would add.
+func computeFacets(products []Product, universe facetUniverse, filter productFilter) ProductFacets {
+	colorCounts := countColorFacet(products, filter.without(facetColor))
+	brandCounts := countFacet(products, filter.without(facetBrand), func(product Product) string {
+		return normalizeToken(product.Brand)
+	})
+	categoryCounts := countFacet(products, filter.without(facetCategory), func(product Product) string {
+		return normalizeToken(product.Category)
+	})
+	conditionCounts := countFacet(products, filter.without(facetCondition), func(product Product) string {
+		return normalizeToken(product.Condition)
+	})
+	bestsellerCounts := countFacet(products, filter.without(facetBestseller), func(product Product) string {
+		return boolFacetValue(product.Bestseller)
+	})
+	onSaleCounts := countFacet(products, filter.without(facetOnSale), func(product Product) string {
+		return boolFacetValue(product.DiscountPercent > 0)
+	})
+
+	return ProductFacets{
+		Colors:     facetValuesWithCounts(universe.colors, colorCounts),
+		Brands:     facetValuesWithCounts(universe.brands, brandCounts),
+		Categories: facetValuesWithCounts(universe.categories, categoryCounts),
+		Conditions: facetValuesWithCounts(universe.conditions, conditionCounts),
+		Bestseller: facetValuesWithCounts([]string{"true", "false"}, bestsellerCounts),
+		OnSale:     facetValuesWithCounts([]string{"true", "false"}, onSaleCounts),
+	}
+}
+
+func (f productFilter) without(facet string) productFilter {
+	switch facet {
+	case facetColor:
+		f.colors = nil
+	case facetBrand:
+		f.brands = nil
+	case facetCategory:
+		f.categories = nil
+	case facetCondition:
+		f.conditions = nil
+	case facetBestseller:
+		f.bestseller = nil
+	case facetOnSale:
+		f.onSale = nil
+	}
+	return f
+}
+
+func countFacet(products []Product, filter productFilter, valueOf func(Product) string) map[string]int {
+	counts := make(map[string]int)
+	for _, product := range products {
+		if !filter.matches(product) {
+			continue
+		}
+		value := valueOf(product)
+		if value == "" {
+			continue
+		}
+		counts[value]++
+	}
+	return counts
+}
+
+// countColorFacet scopes each candidate color as if it were the only selected
+// color, so stock filters (inStock, minStock) use that color's stock.
+func countColorFacet(products []Product, filter productFilter) map[string]int {
+	counts := make(map[string]int)
+	for _, product := range products {
+		for _, color := range normalizeColors(product.Colors) {
+			scoped := filter
+			scoped.colors = map[string]struct{}{color: {}}
+			if !scoped.matches(product) {
+				continue
+			}
+			counts[color]++
+		}
+	}
+	return counts
+}
+
+func facetValuesWithCounts(values []string, counts map[string]int) []FacetValue {
+	out := make([]FacetValue, 0, len(values))
+	for _, value := range values {
+		out = append(out, FacetValue{Value: value, Count: counts[value]})
+	}
+	return out
+}
+
+func boolFacetValue(v bool) string {
+	if v {
+		return "true"
+	}
+	return "false"
+}
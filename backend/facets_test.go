@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func facetCounts(values []FacetValue) map[string]int {
+	counts := make(map[string]int, len(values))
+	for _, value := range values {
+		counts[value.Value] = value.Count
+	}
+	return counts
+}
+
+func facetFixtureSource() *fakeSource {
+	return &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "iPhone 12", BasePrice: 500, Brand: "Apple", Category: "smartphones"},
+			{ID: "p2", Name: "iPad Air", BasePrice: 600, Brand: "Apple", Category: "tablets"},
+			{ID: "p3", Name: "Galaxy S21", BasePrice: 400, Brand: "Samsung", Category: "smartphones"},
+			{ID: "p4", Name: "Galaxy Tab", BasePrice: 300, Brand: "Samsung", Category: "tablets"},
+		},
+		details: []DetailsRecord{
+			{ID: "p1", DiscountPercent: 10, Bestseller: true, Colors: []string{"blue", "red"}, StockByColor: map[string]int{"blue": 2, "red": 0}, Condition: "refurbished"},
+			{ID: "p2", DiscountPercent: 0, Colors: []string{"silver"}, Stock: 4, Condition: "refurbished"},
+			{ID: "p3", DiscountPercent: 20, Bestseller: true, Colors: []string{"red"}, Stock: 1, Condition: "used"},
+			{ID: "p4", DiscountPercent: 0, Colors: []string{"blue"}, Stock: 0, Condition: "used"},
+		},
+	}
+}
+
+func TestProductService_FacetsExcludeOwnFilter(t *testing.T) {
+	service := NewProductService(facetFixtureSource(), 30*time.Second)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{
+		Brands:     []string{"apple"},
+		Categories: []string{"smartphones"},
+	})
+	if err != nil {
+		t.Fatalf("QueryProducts() unexpected error: %v", err)
+	}
+	if response.Total != 1 {
+		t.Fatalf("expected total=1 for apple smartphones, got %d", response.Total)
+	}
+
+	brands := facetCounts(response.Facets.Brands)
+	if brands["apple"] != 1 || brands["samsung"] != 1 {
+		t.Fatalf("expected brand counts ignoring brand filter (apple=1 samsung=1), got %v", brands)
+	}
+
+	categories := facetCounts(response.Facets.Categories)
+	if categories["smartphones"] != 1 || categories["tablets"] != 1 {
+		t.Fatalf("expected category counts ignoring category filter (smartphones=1 tablets=1), got %v", categories)
+	}
+
+	conditions := facetCounts(response.Facets.Conditions)
+	if conditions["refurbished"] != 1 || conditions["used"] != 0 {
+		t.Fatalf("expected condition counts under both filters (refurbished=1 used=0), got %v", conditions)
+	}
+	if len(response.Facets.Conditions) != 2 {
+		t.Fatalf("expected zero-count condition values to be listed, got %v", response.Facets.Conditions)
+	}
+}
+
+func TestProductService_BooleanFacetsListTrueAndFalse(t *testing.T) {
+	service := NewProductService(facetFixtureSource(), 30*time.Second)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{
+		Bestseller: boolPtr(true),
+		OnSale:     boolPtr(true),
+	})
+	if err != nil {
+		t.Fatalf("QueryProducts() unexpected error: %v", err)
+	}
+
+	bestseller := facetCounts(response.Facets.Bestseller)
+	if bestseller["true"] != 2 || bestseller["false"] != 0 {
+		t.Fatalf("expected bestseller counts under onSale filter (true=2 false=0), got %v", bestseller)
+	}
+
+	onSale := facetCounts(response.Facets.OnSale)
+	if onSale["true"] != 2 || onSale["false"] != 0 {
+		t.Fatalf("expected onSale counts under bestseller filter (true=2 false=0), got %v", onSale)
+	}
+}
+
+func TestProductService_ColorFacetUsesColorScopedStock(t *testing.T) {
+	service := NewProductService(facetFixtureSource(), 30*time.Second)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{
+		Colors:  []string{"blue"},
+		InStock: boolPtr(true),
+	})
+	if err != nil {
+		t.Fatalf("QueryProducts() unexpected error: %v", err)
+	}
+
+	colors := facetCounts(response.Facets.Colors)
+	want := map[string]int{"blue": 1, "red": 1, "silver": 1}
+	for color, count := range want {
+		if colors[color] != count {
+			t.Fatalf("expected color facet %s=%d, got %v", color, count, colors)
+		}
+	}
+	if len(response.Facets.Colors) != 3 {
+		t.Fatalf("expected every dataset color to be listed, got %v", response.Facets.Colors)
+	}
+}
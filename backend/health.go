@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	readinessReady    = "ready"
+	readinessNotReady = "not_ready"
+
+	warmUpRetryBaseDelay = 500 * time.Millisecond
+	warmUpRetryMaxDelay  = 30 * time.Second
+)
+
+// sourceHealth is the outcome of the local loads of one source. Snapshots
+// adopted from the shared cache do not touch it.
+type sourceHealth struct {
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+	// failing is set while the latest attempt failed.
+	failing bool
+}
+
+// ReadinessReport backs /health/ready.
+type ReadinessReport struct {
+	Status   string                  `json:"status"`
+	Reason   string                  `json:"reason,omitempty"`
+	Snapshot *SnapshotStatus         `json:"snapshot"`
+	Sources  map[string]SourceStatus `json:"sources"`
+}
+
+// SnapshotStatus describes the snapshot being served. Stale is set once it
+// is past its TTL or the latest load failed.
+type SnapshotStatus struct {
+	Version      string    `json:"version"`
+	BuiltAt      time.Time `json:"built_at"`
+	AgeSeconds   float64   `json:"age_seconds"`
+	ProductCount int       `json:"product_count"`
+	Stale        bool      `json:"stale"`
+	// Restored is set while the snapshot saved by an earlier run serves,
+	// before the first successful load.
+	Restored      bool   `json:"restored,omitempty"`
+	LastLoadError string `json:"last_load_error,omitempty"`
+}
+
+// SourceStatus reports the local loads of one source. Stale is set when its
+// latest load failed and the served snapshot holds its data from an earlier
+// load. Popularity and offers are never stale: a failure drops the ranks or
+// offers instead.
+type SourceStatus struct {
+	LastSuccess *time.Time `json:"last_success"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Stale       bool       `json:"stale"`
+}
+
+// recordSourceResult notes a load of the named source. Loads canceled because
+// another required source failed say nothing about this one and are skipped.
+func (s *ProductService) recordSourceResult(ctx context.Context, name string, err error) {
+	if err != nil && canceledBySibling(ctx, err) {
+		return
+	}
+	now := s.now()
+
+	s.diagnosticsMu.Lock()
+	defer s.diagnosticsMu.Unlock()
+	if s.sourceHealth == nil {
+		s.sourceHealth = make(map[string]*sourceHealth)
+	}
+	health := s.sourceHealth[name]
+	if health == nil {
+		health = &sourceHealth{}
+		s.sourceHealth[name] = health
+	}
+	health.failing = err != nil
+	if err != nil {
+		health.lastError = err.Error()
+		health.lastErrorAt = now
+		return
+	}
+	health.lastSuccess = now
+}
+
+func (s *ProductService) recordLoadResult(err error) {
+	s.diagnosticsMu.Lock()
+	defer s.diagnosticsMu.Unlock()
+	s.lastLoadErr = ""
+	if err != nil {
+		s.lastLoadErr = err.Error()
+	}
+}
+
+// Readiness reports whether a snapshot is available to serve, and the state
+// of every configured source.
+func (s *ProductService) Readiness() ReadinessReport {
+	now := s.now()
+
+	s.mu.Lock()
+	snapshot := s.cached
+	loadedAt := s.loadedAt
+	freshFor := s.freshFor
+	s.mu.Unlock()
+
+	s.diagnosticsMu.Lock()
+	defer s.diagnosticsMu.Unlock()
+
+	names := []string{sourceMetadata, sourceDetails}
+	if s.popularitySource != nil {
+		names = append(names, sourcePopularity)
+	}
+	if s.offerSource != nil {
+		names = append(names, sourceOffers)
+	}
+	report := ReadinessReport{Status: readinessReady, Sources: make(map[string]SourceStatus, len(names))}
+	for _, name := range names {
+		var status SourceStatus
+		if health := s.sourceHealth[name]; health != nil {
+			status.LastSuccess = optionalTime(health.lastSuccess)
+			status.LastError = health.lastError
+			status.LastErrorAt = optionalTime(health.lastErrorAt)
+			status.Stale = health.failing && name != sourcePopularity && name != sourceOffers &&
+				snapshot != nil && !snapshot.builtAt.After(health.lastErrorAt)
+		}
+		report.Sources[name] = status
+	}
+
+	if snapshot == nil {
+		report.Status = readinessNotReady
+		report.Reason = "no product snapshot has been loaded"
+		if s.lastLoadErr != "" {
+			report.Reason += ": " + s.lastLoadErr
+		}
+		return report
+	}
+	age := now.Sub(loadedAt)
+	report.Snapshot = &SnapshotStatus{
+		Version:       snapshot.version,
+		BuiltAt:       snapshot.builtAt,
+		AgeSeconds:    age.Seconds(),
+		ProductCount:  len(snapshot.products),
+		Stale:         age >= freshFor || s.lastLoadErr != "" || snapshot.restored,
+		Restored:      snapshot.restored,
+		LastLoadError: s.lastLoadErr,
+	}
+	return report
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// warm loads a snapshot unless one is cached, adopting a fresh shared
+// snapshot when there is one. A restored snapshot does not count, so warm-up
+// keeps retrying until the sources have been read.
+func (s *ProductService) warm(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.cached != nil && !s.cached.restored {
+			s.mu.Unlock()
+			return nil
+		}
+		if s.loading {
+			loadDone := s.loadDone
+			s.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-loadDone:
+				continue
+			}
+		}
+
+		loadDone := s.beginLoadLocked()
+		s.mu.Unlock()
+
+		_, err := s.runLoad(context.WithoutCancel(ctx), loadDone, false)
+		return err
+	}
+}
+
+// warmUp retries the first snapshot load with capped exponential backoff
+// until it succeeds or ctx ends, so the instance turns ready without waiting
+// for traffic. It reports whether a snapshot was loaded.
+func warmUp(ctx context.Context, service *ProductService, baseDelay, maxDelay time.Duration) bool {
+	started := time.Now()
+	delay := baseDelay
+	for attempt := 1; ; attempt++ {
+		err := service.warm(ctx)
+		if err == nil {
+			slog.InfoContext(ctx, "cache warm-up complete", "attempts", attempt, "duration_ms", float64(time.Since(started).Microseconds())/1000)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		slog.WarnContext(ctx, "cache warm-up failed, retrying", "attempt", attempt, "retry_in", delay.String(), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// healthHandler reports liveness: the process is up and serving HTTP. It
+// says nothing about the data, see readinessHandler.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readinessHandler answers 200 once a product snapshot can be served and 503
+// before that, with the per-source report either way.
+func readinessHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		report := service.Readiness()
+		status := http.StatusOK
+		if report.Status != readinessReady {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, status, report)
+	})
+}
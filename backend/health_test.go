@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fetchReadiness(t *testing.T, handler http.Handler) (int, ReadinessReport) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	var report ReadinessReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid readiness response %q: %v", recorder.Body.String(), err)
+	}
+	return recorder.Code, report
+}
+
+func TestReadiness_RequiresSnapshot(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	service := NewProductService(source, 30*time.Second).WithPopularitySource(&fakePopularitySource{})
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected liveness to pass without data, got %d", recorder.Code)
+	}
+
+	code, report := fetchReadiness(t, handler)
+	if code != http.StatusServiceUnavailable || report.Status != readinessNotReady || report.Snapshot != nil {
+		t.Fatalf("expected not ready before the first load, got %d %+v", code, report)
+	}
+	if len(report.Sources) != 3 || report.Sources[sourceMetadata].LastSuccess != nil {
+		t.Fatalf("expected every configured source without a success, got %+v", report.Sources)
+	}
+
+	if err := service.warm(context.Background()); err != nil {
+		t.Fatalf("unexpected warm-up error: %v", err)
+	}
+	code, report = fetchReadiness(t, handler)
+	if code != http.StatusOK || report.Status != readinessReady {
+		t.Fatalf("expected ready after the first load, got %d %+v", code, report)
+	}
+	if report.Snapshot == nil || report.Snapshot.ProductCount != 1 || report.Snapshot.Stale || report.Snapshot.Version == "" {
+		t.Fatalf("unexpected snapshot status: %+v", report.Snapshot)
+	}
+	for name, status := range report.Sources {
+		if status.LastSuccess == nil || status.LastError != "" || status.Stale {
+			t.Fatalf("expected %s to be healthy, got %+v", name, status)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/health/ready", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", recorder.Code)
+	}
+}
+
+func TestReadiness_ReportsFailingSourcesAndStaleData(t *testing.T) {
+	captureLogOutput(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	popularity := &fakePopularitySource{}
+	service := NewProductService(source, 30*time.Second).WithPopularitySource(popularity)
+	service.now = func() time.Time { return now }
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	source.setErr(errors.New("metadata upstream down"))
+	if err := service.Refresh(context.Background()); err == nil {
+		t.Fatal("expected refresh to fail")
+	}
+
+	report := service.Readiness()
+	if report.Status != readinessReady {
+		t.Fatalf("expected stale data to keep the instance ready, got %+v", report)
+	}
+	if !report.Snapshot.Stale || report.Snapshot.AgeSeconds != 60 || !strings.Contains(report.Snapshot.LastLoadError, "metadata upstream down") {
+		t.Fatalf("expected a stale snapshot with the load error, got %+v", report.Snapshot)
+	}
+	metadata := report.Sources[sourceMetadata]
+	if !metadata.Stale || metadata.LastError != "metadata upstream down" || !metadata.LastErrorAt.Equal(now) || !metadata.LastSuccess.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("unexpected metadata status: %+v", metadata)
+	}
+
+	now = now.Add(time.Second)
+	source.setErr(nil)
+	popularity.err = errors.New("popularity down")
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	report = service.Readiness()
+	if report.Snapshot.Stale || report.Snapshot.LastLoadError != "" || report.Sources[sourceMetadata].Stale {
+		t.Fatalf("expected a successful load to clear staleness, got %+v", report)
+	}
+	if status := report.Sources[sourcePopularity]; status.LastError != "popularity down" || status.Stale {
+		t.Fatalf("expected popularity to report its error without being stale, got %+v", status)
+	}
+}
+
+func TestWarmUp_RetriesUntilSnapshotLoads(t *testing.T) {
+	logs := captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+		err:      errors.New("not yet"),
+	}
+	service := NewProductService(source, 30*time.Second)
+
+	done := make(chan bool, 1)
+	go func() { done <- warmUp(context.Background(), service, time.Millisecond, 5*time.Millisecond) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if metadataCalls, _ := source.callCounts(); metadataCalls >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected warm-up to retry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	source.setErr(nil)
+
+	if !<-done {
+		t.Fatal("expected warm-up to succeed")
+	}
+	if report := service.Readiness(); report.Status != readinessReady {
+		t.Fatalf("expected ready after warm-up, got %+v", report)
+	}
+	if entries := logs.entries(t, "cache warm-up complete"); len(entries) != 1 {
+		t.Fatalf("expected one completion log, got %v", entries)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	failing := NewProductService(&fakeSource{err: errors.New("down")}, 30*time.Second)
+	if warmUp(ctx, failing, time.Hour, time.Hour) {
+		t.Fatal("expected a canceled warm-up to give up")
+	}
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ProductHandler struct {
@@ -23,22 +28,154 @@ func (h *ProductHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, span := startSpan(r.Context(), "ParseProductQuery", attribute.Int("products.query.param_count", len(r.URL.Query())))
 	query, err := ParseProductQuery(r.URL.Query())
+	if err == nil {
+		span.SetAttributes(productQueryAttributes(query)...)
+	}
+	endSpan(span, err)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	response, err := h.service.QueryProducts(r.Context(), query)
+	if errors.Is(err, errInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		log.Printf("products query failed: %v", err)
+		slog.ErrorContext(r.Context(), "products query failed", "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to load products")
 		return
 	}
 
+	setSnapshotHeaders(w, h.service)
+	writeJSON(w, http.StatusOK, response)
+}
+
+type SuggestHandler struct {
+	service *ProductService
+}
+
+func NewSuggestHandler(service *ProductService) http.Handler {
+	return &SuggestHandler{service: service}
+}
+
+func (h *SuggestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query, err := ParseSuggestQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response, err := h.service.SuggestProducts(r.Context(), query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "product suggestions failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load suggestions")
+		return
+	}
+
 	writeJSON(w, http.StatusOK, response)
 }
 
+type ProductDetailHandler struct {
+	service *ProductService
+}
+
+func NewProductDetailHandler(service *ProductService) http.Handler {
+	return &ProductDetailHandler{service: service}
+}
+
+func (h *ProductDetailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "" {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	product, etag, err := h.service.GetProduct(r.Context(), id)
+	if errors.Is(err, errProductNotFound) {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "product lookup failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load product")
+		return
+	}
+
+	setSnapshotHeaders(w, h.service)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, product)
+}
+
+func setSnapshotHeaders(w http.ResponseWriter, service *ProductService) {
+	if version := service.DataVersion(); version != "" {
+		w.Header().Set("X-Data-Version", version)
+	}
+	if version := service.CatalogVersion(); version != "" {
+		w.Header().Set("X-Catalog-Version", version)
+	}
+
+	state, ok := service.CacheState()
+	if !ok {
+		return
+	}
+	age := int64(state.age / time.Second)
+	if age < 0 {
+		age = 0
+	}
+	w.Header().Set("Age", strconv.FormatInt(age, 10))
+	if state.restored {
+		// The snapshot predates this process and the sources have not
+		// confirmed it yet, so downstream caches must not keep it.
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Snapshot-Stale", "true")
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf(
+		"public, max-age=%d, stale-while-revalidate=%d",
+		int64(state.ttl/time.Second),
+		int64((state.maxStale-state.ttl)/time.Second),
+	))
+}
+
+func etagMatches(ifNoneMatch string, etag string) bool {
+	ifNoneMatch = strings.TrimSpace(ifNoneMatch)
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	if ifNoneMatch == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func withCORS(next http.Handler, allowOrigin string) http.Handler {
 	origin := strings.TrimSpace(allowOrigin)
 	if origin == "" {
@@ -51,7 +188,8 @@ func withCORS(next http.Handler, allowOrigin string) http.Handler {
 			w.Header().Add("Vary", "Origin")
 		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-None-Match, X-API-Key, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "Age, ETag, RateLimit-Limit, RateLimit-Policy, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Catalog-Version, X-Data-Version, X-Request-ID, X-Snapshot-Stale")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -62,20 +200,12 @@ func withCORS(next http.Handler, allowOrigin string) http.Handler {
 	})
 }
 
-func withLogging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s (%s)", r.Method, r.URL.Path, time.Since(start))
-	})
-}
-
 func writeJSON(w http.ResponseWriter, statusCode int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		log.Printf("json encode failed: %v", err)
+		slog.Error("json encode failed", "error", err)
 	}
 }
 
@@ -232,3 +232,155 @@ func TestProductHandler_InternalError(t *testing.T) {
 		t.Fatalf("expected generic server error message, got %q", response.Error)
 	}
 }
+
+func TestProductDetailHandler_SuccessSetsETag(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Phone", BasePrice: 100, Brand: "apple"},
+			{ID: "p2", Name: "Tablet", BasePrice: 300, Brand: "samsung"},
+		},
+		details: []DetailsRecord{
+			{ID: "p1", DiscountPercent: 20, Colors: []string{"blue"}, Stock: 3},
+			{ID: "p2", DiscountPercent: 0, Colors: []string{"black"}, Stock: 1},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/products/{id}", NewProductDetailHandler(NewProductService(source, 30*time.Second)))
+
+	request := httptest.NewRequest(http.MethodGet, "/products/p2", nil)
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	etag := recorder.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 3 {
+		t.Fatalf("expected strong quoted ETag, got %q", etag)
+	}
+
+	var product Product
+	if err := json.Unmarshal(recorder.Body.Bytes(), &product); err != nil {
+		t.Fatalf("failed to unmarshal product response: %v", err)
+	}
+	if product.ID != "p2" || product.Name != "Tablet" || product.Price != 300 {
+		t.Fatalf("expected merged product p2, got %+v", product)
+	}
+}
+
+func TestProductDetailHandler_IfNoneMatchReturnsNotModified(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", DiscountPercent: 0}},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/products/{id}", NewProductDetailHandler(NewProductService(source, 30*time.Second)))
+
+	first := httptest.NewRecorder()
+	mux.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/products/p1", nil))
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected ETag on first response")
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/products/p1", nil)
+	request.Header.Set("If-None-Match", `"other", `+etag)
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusNotModified {
+		t.Fatalf("expected status 304, got %d", recorder.Code)
+	}
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("expected empty body for 304, got %q", recorder.Body.String())
+	}
+	if got := recorder.Header().Get("ETag"); got != etag {
+		t.Fatalf("expected 304 to echo ETag %q, got %q", etag, got)
+	}
+
+	mismatch := httptest.NewRequest(http.MethodGet, "/products/p1", nil)
+	mismatch.Header.Set("If-None-Match", `"stale"`)
+	mismatchRecorder := httptest.NewRecorder()
+	mux.ServeHTTP(mismatchRecorder, mismatch)
+	if mismatchRecorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for mismatched If-None-Match, got %d", mismatchRecorder.Code)
+	}
+}
+
+func TestProductDetailHandler_UnknownIDReturnsNotFound(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", DiscountPercent: 0}},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/products/{id}", NewProductDetailHandler(NewProductService(source, 30*time.Second)))
+
+	request := httptest.NewRequest(http.MethodGet, "/products/missing", nil)
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", recorder.Code)
+	}
+	var response errorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	if response.Error != "product not found" {
+		t.Fatalf("expected product not found error, got %q", response.Error)
+	}
+}
+
+func TestProductHandler_InvalidCursorReturnsBadRequest(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", DiscountPercent: 0}},
+	}
+	handler := NewProductHandler(NewProductService(source, 30*time.Second))
+
+	request := httptest.NewRequest(http.MethodGet, "/products?cursor=forged.cursor", nil)
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", recorder.Code)
+	}
+	var response errorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	if !strings.Contains(response.Error, "invalid cursor") {
+		t.Fatalf("expected invalid cursor error, got %q", response.Error)
+	}
+}
+
+func TestProductHandler_SetsCacheControlAndAgeFromSnapshot(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", DiscountPercent: 0}},
+	}
+	now := time.Date(2026, 2, 24, 19, 0, 0, 0, time.UTC)
+	service := NewProductService(source, 30*time.Second).WithMaxStaleness(2 * time.Minute)
+	service.now = func() time.Time { return now }
+	handler := NewProductHandler(service)
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/products", nil))
+	if got := first.Header().Get("Age"); got != "0" {
+		t.Fatalf("expected Age=0 for a freshly built snapshot, got %q", got)
+	}
+	if got := first.Header().Get("Cache-Control"); got != "public, max-age=30, stale-while-revalidate=90" {
+		t.Fatalf("expected Cache-Control from ttl and max staleness, got %q", got)
+	}
+
+	now = now.Add(12 * time.Second)
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/products", nil))
+	if got := second.Header().Get("Age"); got != "12" {
+		t.Fatalf("expected Age=12 after 12s, got %q", got)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	metadataEndpointPath   = "/metadata"
+	detailsEndpointPath    = "/details"
+	popularityEndpointPath = "/popularity"
+	offersEndpointPath     = "/offers"
+	maxSourceResponseBytes = 32 << 20
+)
+
+var errSourceDecode = errors.New("invalid source payload")
+
+type HTTPSourceOptions struct {
+	Client           *http.Client
+	Timeout          time.Duration
+	MaxRetries       int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+type HTTPProductSource struct {
+	metadata *httpEndpoint[MetadataRecord]
+	details  *httpEndpoint[DetailsRecord]
+}
+
+type HTTPPopularitySource struct {
+	popularity *httpEndpoint[PopularityRecord]
+}
+
+type HTTPOfferSource struct {
+	offers *httpEndpoint[OfferRecord]
+}
+
+// httpEndpoint fetches one JSON array with per-attempt timeouts, jittered
+// exponential backoff and a circuit breaker. It remembers the last body's
+// validators so unchanged data costs a 304 instead of a download.
+type httpEndpoint[T any] struct {
+	url     string
+	options HTTPSourceOptions
+	breaker *circuitBreaker
+	sleep   func(context.Context, time.Duration) error
+
+	mu           sync.Mutex
+	loaded       bool
+	etag         string
+	lastModified string
+	hash         string
+	records      []T
+}
+
+type sourceStatusError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *sourceStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.status)
+}
+
+func NewHTTPProductSource(baseURL string, options HTTPSourceOptions) *HTTPProductSource {
+	return &HTTPProductSource{
+		metadata: newHTTPEndpoint[MetadataRecord](joinSourceURL(baseURL, metadataEndpointPath), options),
+		details:  newHTTPEndpoint[DetailsRecord](joinSourceURL(baseURL, detailsEndpointPath), options),
+	}
+}
+
+func NewHTTPPopularitySource(baseURL string, options HTTPSourceOptions) *HTTPPopularitySource {
+	return &HTTPPopularitySource{
+		popularity: newHTTPEndpoint[PopularityRecord](joinSourceURL(baseURL, popularityEndpointPath), options),
+	}
+}
+
+func NewHTTPOfferSource(baseURL string, options HTTPSourceOptions) *HTTPOfferSource {
+	return &HTTPOfferSource{
+		offers: newHTTPEndpoint[OfferRecord](joinSourceURL(baseURL, offersEndpointPath), options),
+	}
+}
+
+func (s *HTTPProductSource) LoadMetadata(ctx context.Context) ([]MetadataRecord, error) {
+	return s.metadata.load(ctx)
+}
+
+func (s *HTTPProductSource) LoadDetails(ctx context.Context) ([]DetailsRecord, error) {
+	return s.details.load(ctx)
+}
+
+func (s *HTTPProductSource) DataVersion() string {
+	metadataHash := s.metadata.contentHash()
+	detailsHash := s.details.contentHash()
+	if metadataHash == "" || detailsHash == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(metadataHash + ":" + detailsHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *HTTPPopularitySource) LoadPopularity(ctx context.Context) ([]PopularityRecord, error) {
+	return s.popularity.load(ctx)
+}
+
+func (s *HTTPOfferSource) LoadOffers(ctx context.Context) ([]OfferRecord, error) {
+	return s.offers.load(ctx)
+}
+
+func joinSourceURL(baseURL string, path string) string {
+	return strings.TrimRight(strings.TrimSpace(baseURL), "/") + path
+}
+
+func newHTTPEndpoint[T any](url string, options HTTPSourceOptions) *httpEndpoint[T] {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultSourceTimeout
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = 0
+	}
+	if options.RetryBaseDelay <= 0 {
+		options.RetryBaseDelay = DefaultSourceRetryBaseDelay
+	}
+	if options.RetryMaxDelay < options.RetryBaseDelay {
+		options.RetryMaxDelay = options.RetryBaseDelay
+	}
+
+	return &httpEndpoint[T]{
+		url:     url,
+		options: options,
+		breaker: newCircuitBreaker(options.BreakerThreshold, options.BreakerCooldown),
+		sleep:   sleepContext,
+	}
+}
+
+func (e *httpEndpoint[T]) load(ctx context.Context) ([]T, error) {
+	if !e.breaker.allow() {
+		return nil, fmt.Errorf("fetch %s: %w", e.url, errCircuitOpen)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var records []T
+		records, err = e.fetch(ctx)
+		if err == nil {
+			e.breaker.record(nil)
+			return records, nil
+		}
+		if attempt >= e.options.MaxRetries || !retryableSourceError(ctx, err) {
+			break
+		}
+
+		delay := e.backoff(attempt, err)
+		slog.DebugContext(ctx, "source request failed, retrying", "url", e.url, "attempt", attempt+1, "delay", delay.String(), "error", err)
+		if sleepErr := e.sleep(ctx, delay); sleepErr != nil {
+			err = sleepErr
+			break
+		}
+	}
+
+	// A load abandoned by its caller, for instance because a sibling source
+	// failed, is not an upstream failure.
+	if ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		e.breaker.release()
+	} else {
+		e.breaker.record(err)
+	}
+	return nil, fmt.Errorf("fetch %s: %w", e.url, err)
+}
+
+func (e *httpEndpoint[T]) fetch(ctx context.Context) ([]T, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, e.options.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, e.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if id := requestIDFromContext(ctx); id != "" {
+		request.Header.Set(requestIDHeader, id)
+	}
+	tracePropagator.Inject(attemptCtx, propagation.HeaderCarrier(request.Header))
+
+	e.mu.Lock()
+	if e.loaded {
+		if e.etag != "" {
+			request.Header.Set("If-None-Match", e.etag)
+		}
+		if e.lastModified != "" {
+			request.Header.Set("If-Modified-Since", e.lastModified)
+		}
+	}
+	e.mu.Unlock()
+
+	response, err := e.options.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotModified:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if !e.loaded {
+			return nil, fmt.Errorf("unexpected status %d without a cached response", response.StatusCode)
+		}
+		slog.DebugContext(ctx, "source not modified", "url", e.url, "records", len(e.records))
+		return slices.Clone(e.records), nil
+	case response.StatusCode != http.StatusOK:
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+		return nil, &sourceStatusError{status: response.StatusCode, retryAfter: parseRetryAfter(response.Header.Get("Retry-After"))}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxSourceResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSourceResponseBytes {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxSourceResponseBytes)
+	}
+
+	var records []T
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, fmt.Errorf("decode: %w", errors.Join(errSourceDecode, err))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loaded = true
+	e.etag = response.Header.Get("ETag")
+	e.lastModified = response.Header.Get("Last-Modified")
+	e.hash = hashContent(body)
+	e.records = records
+	slog.DebugContext(ctx, "source loaded", "url", e.url, "records", len(records))
+	return slices.Clone(records), nil
+}
+
+func (e *httpEndpoint[T]) contentHash() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.hash
+}
+
+// backoff uses full jitter: a random delay up to the exponential bound, so
+// replicas retrying the same outage spread out. A Retry-After hint from the
+// upstream is honored when it fits within the maximum delay.
+func (e *httpEndpoint[T]) backoff(attempt int, err error) time.Duration {
+	var statusErr *sourceStatusError
+	if errors.As(err, &statusErr) && statusErr.retryAfter > 0 && statusErr.retryAfter <= e.options.RetryMaxDelay {
+		return statusErr.retryAfter
+	}
+
+	bound := e.options.RetryBaseDelay << attempt
+	if bound <= 0 || bound > e.options.RetryMaxDelay {
+		bound = e.options.RetryMaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(bound) + 1))
+}
+
+func retryableSourceError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, errSourceDecode) {
+		return false
+	}
+	var statusErr *sourceStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status == http.StatusTooManyRequests || statusErr.status >= http.StatusInternalServerError
+	}
+	return true
+}
+
+func parseRetryAfter(raw string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
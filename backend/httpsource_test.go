@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// noSleep records backoff delays instead of waiting, so retry tests run
+// instantly.
+func noSleep(delays *[]time.Duration) func(context.Context, time.Duration) error {
+	var mu sync.Mutex
+	return func(_ context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*delays = append(*delays, d)
+		return nil
+	}
+}
+
+func TestHTTPProductSource_ConditionalGetReusesRecords(t *testing.T) {
+	var mu sync.Mutex
+	var received []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		received = append(received, r.Header.Clone())
+		mu.Unlock()
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 01 Jan 2025 00:00:00 GMT")
+		_, _ = w.Write([]byte(`[{"id":"p1","name":"Phone","base_price":100}]`))
+	}))
+	defer server.Close()
+
+	source := NewHTTPProductSource(server.URL+"/", HTTPSourceOptions{})
+	ctx := contextWithRequestID(context.Background(), "req-123")
+
+	first, err := source.LoadMetadata(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first) != 1 || first[0].ID != "p1" {
+		t.Fatalf("unexpected records: %+v", first)
+	}
+
+	second, err := source.LoadMetadata(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error on revalidation: %v", err)
+	}
+	if len(second) != 1 || second[0].Name != "Phone" {
+		t.Fatalf("expected cached records on 304, got %+v", second)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(received))
+	}
+	if received[0].Get("If-None-Match") != "" || received[0].Get(requestIDHeader) != "req-123" {
+		t.Fatalf("expected unconditional first request carrying the request id, got %v", received[0])
+	}
+	if received[1].Get("If-None-Match") != `"v1"` || received[1].Get("If-Modified-Since") != "Wed, 01 Jan 2025 00:00:00 GMT" {
+		t.Fatalf("expected conditional headers on revalidation, got %v", received[1])
+	}
+}
+
+func TestHTTPProductSource_DataVersionTracksContent(t *testing.T) {
+	var mu sync.Mutex
+	name := "Phone"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/metadata":
+			_, _ = w.Write([]byte(`[{"id":"p1","name":"` + name + `","base_price":100}]`))
+		case "/details":
+			_, _ = w.Write([]byte(`[{"id":"p1"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := NewHTTPProductSource(server.URL, HTTPSourceOptions{})
+	if source.DataVersion() != "" {
+		t.Fatal("expected empty data version before the first load")
+	}
+	load := func() string {
+		t.Helper()
+		if _, err := source.LoadMetadata(context.Background()); err != nil {
+			t.Fatalf("unexpected metadata error: %v", err)
+		}
+		if _, err := source.LoadDetails(context.Background()); err != nil {
+			t.Fatalf("unexpected details error: %v", err)
+		}
+		return source.DataVersion()
+	}
+
+	first := load()
+	if first == "" || load() != first {
+		t.Fatalf("expected stable non-empty data version, got %q", first)
+	}
+	mu.Lock()
+	name = "Smartphone"
+	mu.Unlock()
+	if load() == first {
+		t.Fatal("expected data version to change with upstream content")
+	}
+}
+
+func TestHTTPPopularitySource_RetriesTransientFailures(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id":"p1","rank":1}]`))
+	}))
+	defer server.Close()
+
+	source := NewHTTPPopularitySource(server.URL, HTTPSourceOptions{MaxRetries: 2, RetryBaseDelay: 10 * time.Millisecond, RetryMaxDelay: 40 * time.Millisecond})
+	var delays []time.Duration
+	source.popularity.sleep = noSleep(&delays)
+
+	records, err := source.LoadPopularity(context.Background())
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if len(records) != 1 || requests.Load() != 3 {
+		t.Fatalf("expected 1 record after 3 requests, got %d records / %d requests", len(records), requests.Load())
+	}
+	if len(delays) != 2 {
+		t.Fatalf("expected 2 backoff delays, got %v", delays)
+	}
+	for i, delay := range delays {
+		if bound := (10 * time.Millisecond) << i; delay < 0 || delay > bound {
+			t.Fatalf("expected jittered delay %d within [0, %s], got %s", i, bound, delay)
+		}
+	}
+}
+
+func TestHTTPPopularitySource_HonorsRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	source := NewHTTPPopularitySource(server.URL, HTTPSourceOptions{MaxRetries: 1, RetryMaxDelay: 2 * time.Second})
+	var delays []time.Duration
+	source.popularity.sleep = noSleep(&delays)
+
+	if _, err := source.LoadPopularity(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(delays) != 1 || delays[0] != time.Second {
+		t.Fatalf("expected Retry-After delay of 1s, got %v", delays)
+	}
+}
+
+func TestHTTPProductSource_DoesNotRetryPermanentFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"not found", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }},
+		{"malformed body", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(`{not-json`)) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				tc.handler(w, r)
+			}))
+			defer server.Close()
+
+			source := NewHTTPProductSource(server.URL, HTTPSourceOptions{MaxRetries: 3})
+			var delays []time.Duration
+			source.details.sleep = noSleep(&delays)
+
+			if _, err := source.LoadDetails(context.Background()); err == nil {
+				t.Fatal("expected error")
+			}
+			if requests.Load() != 1 || len(delays) != 0 {
+				t.Fatalf("expected a single attempt, got %d requests and delays %v", requests.Load(), delays)
+			}
+		})
+	}
+}
+
+func TestHTTPProductSource_PerCallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	source := NewHTTPProductSource(server.URL, HTTPSourceOptions{Timeout: 20 * time.Millisecond})
+	start := time.Now()
+	_, err := source.LoadMetadata(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the per-call timeout to bound the request, took %s", elapsed)
+	}
+}
+
+func TestHTTPProductSource_CircuitBreakerFailsFastAndRecovers(t *testing.T) {
+	var requests atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	source := NewHTTPProductSource(server.URL, HTTPSourceOptions{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	source.metadata.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := source.LoadMetadata(context.Background()); err == nil {
+			t.Fatal("expected upstream error")
+		}
+	}
+	if state := source.metadata.breaker.currentState(); state != breakerOpen {
+		t.Fatalf("expected open breaker after threshold, got %s", state)
+	}
+
+	if _, err := source.LoadMetadata(context.Background()); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected fail-fast circuit open error, got %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Fatalf("expected no upstream request while open, got %d requests", requests.Load())
+	}
+	if _, err := source.LoadDetails(context.Background()); errors.Is(err, errCircuitOpen) {
+		t.Fatal("expected each endpoint to have its own breaker")
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := source.LoadMetadata(context.Background()); err == nil || errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected half-open trial to reach the upstream and fail, got %v", err)
+	}
+	if state := source.metadata.breaker.currentState(); state != breakerOpen {
+		t.Fatalf("expected failed trial to reopen the breaker, got %s", state)
+	}
+
+	now = now.Add(time.Minute)
+	healthy.Store(true)
+	if _, err := source.LoadMetadata(context.Background()); err != nil {
+		t.Fatalf("expected successful trial, got %v", err)
+	}
+	if state := source.metadata.breaker.currentState(); state != breakerClosed {
+		t.Fatalf("expected closed breaker after recovery, got %s", state)
+	}
+}
+
+func TestHTTPProductSource_SiblingCancellationDoesNotTripBreaker(t *testing.T) {
+	captureLogOutput(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Details never answers before the metadata failure cancels it.
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	source := NewHTTPProductSource(server.URL, HTTPSourceOptions{Timeout: time.Minute, BreakerThreshold: 2, BreakerCooldown: time.Minute})
+	service := NewProductService(source, 30*time.Second)
+	for i := 0; i < 2*DefaultSourceBreakerThreshold; i++ {
+		if err := service.Refresh(context.Background()); err == nil {
+			t.Fatal("expected the metadata failure to fail the refresh")
+		}
+	}
+	if state := source.metadata.breaker.currentState(); state != breakerOpen {
+		t.Fatalf("expected the failing metadata breaker to open, got %s", state)
+	}
+	if state := source.details.breaker.currentState(); state != breakerClosed {
+		t.Fatalf("expected canceled details loads to leave its breaker closed, got %s", state)
+	}
+
+	breaker := newCircuitBreaker(1, time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return now }
+	breaker.record(errors.New("upstream down"))
+	now = now.Add(time.Minute)
+	if !breaker.allow() {
+		t.Fatal("expected a half-open trial")
+	}
+	breaker.release()
+	if !breaker.allow() || breaker.currentState() != breakerHalfOpen {
+		t.Fatalf("expected a released trial to let the next call try, got %s", breaker.currentState())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestID_EchoesValidIncomingID(t *testing.T) {
+	captureLogOutput(t)
+	handler := buildServerHandler(NewProductService(&fakeSource{}, 30*time.Second), NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	request := httptest.NewRequest(http.MethodGet, "/health", nil)
+	request.Header.Set(requestIDHeader, "edge-1234")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if got := recorder.Header().Get(requestIDHeader); got != "edge-1234" {
+		t.Fatalf("expected incoming request id to be echoed, got %q", got)
+	}
+}
+
+func TestRequestID_ReplacesMissingOrMalformedID(t *testing.T) {
+	captureLogOutput(t)
+	handler := buildServerHandler(NewProductService(&fakeSource{}, 30*time.Second), NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	for _, incoming := range []string{"", "has space", strings.Repeat("x", maxRequestIDLength+1)} {
+		request := httptest.NewRequest(http.MethodGet, "/health", nil)
+		request.Header.Set(requestIDHeader, incoming)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		got := recorder.Header().Get(requestIDHeader)
+		if got == "" || got == incoming || len(got) != 32 {
+			t.Fatalf("expected generated request id for %q, got %q", incoming, got)
+		}
+	}
+}
+
+func TestRequestID_PropagatesIntoServiceAndSourceLogs(t *testing.T) {
+	logs := captureLogOutput(t)
+	fixture := writeWatchedFixture(t)
+	source := NewWatchedFileSource(fixture.metadataPath, fixture.detailsPath, fixture.popularityPath, fixture.offersPath)
+	service := NewProductService(source, 30*time.Second).WithPopularitySource(source)
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	request := httptest.NewRequest(http.MethodGet, "/products?search=phone", nil)
+	request.Header.Set(requestIDHeader, "trace-abc")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	sourceLogs := logs.entries(t, "source file loaded")
+	if len(sourceLogs) != 3 {
+		t.Fatalf("expected one source log per file, got %d: %s", len(sourceLogs), logs.String())
+	}
+	for _, entry := range sourceLogs {
+		if entry["request_id"] != "trace-abc" {
+			t.Fatalf("expected source log to carry request id, got %v", entry)
+		}
+	}
+	queried := logs.entries(t, "products queried")
+	if len(queried) != 1 || queried[0]["request_id"] != "trace-abc" {
+		t.Fatalf("expected query log to carry request id, got %v", queried)
+	}
+	if access := assertAccessLogged(t, logs, http.MethodGet, "/products"); access["request_id"] != "trace-abc" || access["query"] != "search=phone" {
+		t.Fatalf("unexpected access log %v", access)
+	}
+}
+
+func TestAccessLog_ReportsCacheHitAndOmitsOutcomeForUncachedRoutes(t *testing.T) {
+	logs := captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	handler := buildServerHandler(NewProductService(source, 30*time.Second), NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	for _, target := range []string{"/products", "/products/p1", "/health"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	if entry := assertAccessLogged(t, logs, http.MethodGet, "/products/p1"); entry["cache"] != snapshotLookupHit {
+		t.Fatalf("expected cache hit outcome, got %v", entry["cache"])
+	}
+	if entry := assertAccessLogged(t, logs, http.MethodGet, "/health"); entry["cache"] != nil {
+		t.Fatalf("expected no cache outcome for /health, got %v", entry["cache"])
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		" warn": slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for raw, want := range cases {
+		got, err := parseLogLevel(raw)
+		if err != nil || got != want {
+			t.Fatalf("parseLogLevel(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Fatal("expected error for unknown level")
+	}
+}
+
+func TestLogger_FiltersBelowConfiguredLevel(t *testing.T) {
+	buffer := &logBuffer{}
+	logger := newLogger(buffer, slog.LevelWarn)
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	if strings.Contains(buffer.String(), "hidden") || !strings.Contains(buffer.String(), `"msg":"shown"`) {
+		t.Fatalf("unexpected log output %q", buffer.String())
+	}
+}
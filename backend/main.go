@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,23 +16,128 @@ import (
 )
 
 func main() {
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
+	config, err := loadServerConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(config.redacted()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	config := loadServerConfig()
+	slog.SetDefault(newLogger(os.Stdout, config.LogLevel))
+	if config.CursorSecret == "" {
+		slog.Warn("no cursor secret configured, pagination cursors are signed with a per-process key and stop working after a restart", "setting", envPrefix+"CURSOR_SECRET")
+	}
+
+	shutdownTracing, err := setupTracing(ctx, config.TracingExporter, os.Stdout)
+	if err != nil {
+		slog.Error("invalid tracing configuration", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error("trace exporter shutdown error", "error", err)
+		}
+	}()
+
+	var source ProductSource
+	var popularity PopularitySource
+	var offers OfferSource
+	var watched *WatchedFileSource
+	if config.SourceBaseURL != "" {
+		options := HTTPSourceOptions{Timeout: config.SourceTimeout, MaxRetries: config.SourceRetries}
+		source = NewHTTPProductSource(config.SourceBaseURL, options)
+		popularity = NewHTTPPopularitySource(config.PopularityBaseURL, options)
+		offers = NewHTTPOfferSource(config.OffersBaseURL, options)
+	} else {
+		watched = NewWatchedFileSource(
+			filepath.Join(config.DataDir, "metadata.json"),
+			filepath.Join(config.DataDir, "details.json"),
+			filepath.Join(config.DataDir, "popularity.json"),
+			filepath.Join(config.DataDir, "offers.json"),
+		)
+		source, popularity, offers = watched, watched, watched
+	}
+
+	validationPolicies, err := parseValidationPolicies(config.ValidationPolicies)
+	if err != nil {
+		slog.Error("invalid validation policy configuration", "error", err)
+		os.Exit(1)
+	}
 
-	source := FileProductSource{
-		MetadataPath: filepath.Join(config.DataDir, "metadata.json"),
-		DetailsPath:  filepath.Join(config.DataDir, "details.json"),
+	metrics := NewMetrics()
+	service := NewProductService(source, config.CacheTTL).
+		WithMaxStaleness(config.CacheMaxStale).
+		WithCatalogVersions(config.CatalogVersions).
+		WithSourceIntervals(map[string]time.Duration{
+			sourceMetadata:   config.MetadataRefresh,
+			sourceDetails:    config.DetailsRefresh,
+			sourcePopularity: config.PopularityRefresh,
+			sourceOffers:     config.OffersRefresh,
+		}).
+		WithPopularitySource(popularity).
+		WithOfferSource(offers, config.BestOfferPolicy).
+		WithCursorSecret(config.CursorSecret).
+		WithValidationPolicies(validationPolicies).
+		WithMetrics(metrics)
+	if config.PriceHistoryFile != "" {
+		history, err := OpenPriceHistory(config.PriceHistoryFile, time.Now())
+		if err != nil {
+			slog.Error("price history unavailable", "path", config.PriceHistoryFile, "error", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := history.Close(); err != nil {
+				slog.Error("price history close error", "error", err)
+			}
+		}()
+		service.WithPriceHistory(history)
+	}
+	if config.SnapshotFile != "" {
+		service.WithSnapshotFile(NewSnapshotFile(config.SnapshotFile))
+		if err := service.RestoreSnapshot(ctx); err != nil {
+			slog.Warn("saved snapshot not restored, starting without it", "path", config.SnapshotFile, "error", err)
+		}
+	}
+	if config.RedisURL != "" {
+		cache, err := NewRedisSnapshotCache(config.RedisURL)
+		if err != nil {
+			slog.Error("invalid snapshot cache configuration", "error", err)
+			os.Exit(1)
+		}
+		service.WithSnapshotCache(cache)
 	}
-	popularitySource := FilePopularitySource{
-		Path: filepath.Join(config.DataDir, "popularity.json"),
+
+	// HTTP sources are revalidated with conditional GETs when the TTL expires;
+	// only local files are polled for changes.
+	if watched != nil {
+		go watched.Watch(ctx, config.DataPoll, func(ctx context.Context) {
+			if err := service.Refresh(ctx); err != nil {
+				slog.ErrorContext(ctx, "data reload failed", "error", err)
+				return
+			}
+			slog.InfoContext(ctx, "data reloaded", "data_version", service.DataVersion())
+		})
 	}
-	service := NewProductService(source, config.CacheTTL).WithPopularitySource(popularitySource)
 
 	server := &http.Server{
 		Addr:              config.Address(),
-		Handler:           buildServerHandler(service, config.CORSAllowOrigin),
+		Handler:           buildServerHandler(service, metrics, config),
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      15 * time.Second,
@@ -43,29 +151,49 @@ func main() {
 		defer cancel()
 
 		if err := server.Shutdown(shutdownCtx); err != nil {
-			log.Printf("server shutdown error: %v", err)
+			slog.Error("server shutdown error", "error", err)
 		}
 	}()
 
-	log.Printf("Server starting on http://%s", config.LogAddress())
+	if config.Warmup {
+		go warmUp(ctx, service, warmUpRetryBaseDelay, warmUpRetryMaxDelay)
+	}
+
+	slog.Info("server starting", "url", "http://"+config.LogAddress(), "log_level", config.LogLevel.String())
 	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatal(err)
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
 	}
-	log.Println("Server stopped")
+	slog.Info("server stopped")
 }
 
-func buildServerHandler(service *ProductService, corsAllowOrigin string) http.Handler {
+func buildServerHandler(service *ProductService, metrics *Metrics, config serverConfig) http.Handler {
+	admin := func(next http.Handler) http.Handler { return withAdminAuth(next, config.AdminToken) }
+
 	mux := http.NewServeMux()
 	mux.Handle("/products", NewProductHandler(service))
+	mux.Handle("/products/suggest", NewSuggestHandler(service))
+	mux.Handle("/products/{id}", NewProductDetailHandler(service))
+	mux.Handle("/products/{id}/price-history", priceHistoryHandler(service))
 	mux.HandleFunc("/health", healthHandler)
-	return withCORS(withLogging(mux), corsAllowOrigin)
-}
-
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", http.MethodGet)
-		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-		return
+	mux.HandleFunc("/health/live", healthHandler)
+	mux.Handle("/health/ready", readinessHandler(service))
+	mux.Handle("/metrics", metricsHandler(metrics, service))
+	mux.Handle("/admin/data-quality", admin(dataQualityHandler(service)))
+	mux.Handle("/admin/orphans", admin(orphansHandler(service)))
+	mux.Handle("/admin/cache", admin(cacheInvalidateHandler(service)))
+	mux.Handle("/admin/cache/refresh", admin(cacheRefreshHandler(service)))
+	mux.Handle("/admin/catalog/versions", admin(catalogVersionsHandler(service)))
+	mux.Handle("/admin/catalog/versions/{id}/pin", admin(catalogPinHandler(service)))
+	mux.Handle("/admin/catalog/pin", admin(catalogUnpinHandler(service)))
+	limiter := newRateLimiter(config.RateLimits, config.TrustedProxies, config.RateLimitAPIKeys)
+	handler := withRateLimit(mux, mux, limiter)
+	if config.Compression {
+		handler = withCompression(handler, config.CompressionMinBytes)
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	handler = withMetrics(handler, mux, metrics)
+	handler = withLogging(handler)
+	handler = withTracing(handler, mux)
+	handler = withRequestID(handler)
+	return withCORS(handler, config.CORSAllowOrigin)
 }
@@ -3,10 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -14,7 +15,7 @@ import (
 func TestBuildServerHandler_HealthGet(t *testing.T) {
 	logBuffer := captureLogOutput(t)
 	service := NewProductService(&fakeSource{}, 30*time.Second)
-	handler := buildServerHandler(service, "http://localhost:5173")
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "http://localhost:5173"})
 
 	request := httptest.NewRequest(http.MethodGet, "/health", nil)
 	recorder := httptest.NewRecorder()
@@ -42,15 +43,13 @@ func TestBuildServerHandler_HealthGet(t *testing.T) {
 		t.Fatalf("expected health status ok, got %q", payload["status"])
 	}
 
-	if !strings.Contains(logBuffer.String(), "GET /health") {
-		t.Fatalf("expected request log to include GET /health, got %q", logBuffer.String())
-	}
+	assertAccessLogged(t, logBuffer, http.MethodGet, "/health")
 }
 
 func TestBuildServerHandler_HealthMethodNotAllowed(t *testing.T) {
 	logBuffer := captureLogOutput(t)
 	service := NewProductService(&fakeSource{}, 30*time.Second)
-	handler := buildServerHandler(service, "*")
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
 
 	request := httptest.NewRequest(http.MethodPost, "/health", nil)
 	recorder := httptest.NewRecorder()
@@ -75,8 +74,8 @@ func TestBuildServerHandler_HealthMethodNotAllowed(t *testing.T) {
 		t.Fatalf("expected method not allowed error, got %q", payload.Error)
 	}
 
-	if !strings.Contains(logBuffer.String(), "POST /health") {
-		t.Fatalf("expected request log to include POST /health, got %q", logBuffer.String())
+	if entry := assertAccessLogged(t, logBuffer, http.MethodPost, "/health"); entry["status"] != float64(http.StatusMethodNotAllowed) {
+		t.Fatalf("expected access log status 405, got %v", entry["status"])
 	}
 }
 
@@ -91,7 +90,7 @@ func TestBuildServerHandler_ProductsRouteRegistered(t *testing.T) {
 		},
 	}
 	service := NewProductService(source, 30*time.Second)
-	handler := buildServerHandler(service, "*")
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
 
 	request := httptest.NewRequest(http.MethodGet, "/products?limit=1&offset=0", nil)
 	recorder := httptest.NewRecorder()
@@ -116,28 +115,134 @@ func TestBuildServerHandler_ProductsRouteRegistered(t *testing.T) {
 		t.Fatalf("expected one product via registered /products route, got total=%d items=%d", payload.Total, len(payload.Items))
 	}
 
-	if !strings.Contains(logBuffer.String(), "GET /products") {
-		t.Fatalf("expected request log to include GET /products, got %q", logBuffer.String())
+	entry := assertAccessLogged(t, logBuffer, http.MethodGet, "/products")
+	if entry["status"] != float64(http.StatusOK) || entry["query"] != "limit=1&offset=0" || entry["cache"] != snapshotLookupMiss {
+		t.Fatalf("unexpected access log fields %v", entry)
+	}
+	if entry["bytes"] != float64(recorder.Body.Len()) {
+		t.Fatalf("expected access log bytes %d, got %v", recorder.Body.Len(), entry["bytes"])
+	}
+	if entry["request_id"] == "" || entry["request_id"] != recorder.Header().Get(requestIDHeader) {
+		t.Fatalf("expected access log request_id to match response header, got %v", entry["request_id"])
 	}
 }
 
-func captureLogOutput(t *testing.T) *bytes.Buffer {
+func TestBuildServerHandler_ProductDetailRouteRegistered(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", DiscountPercent: 0}},
+	}
+	handler := buildServerHandler(NewProductService(source, 30*time.Second), NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	request := httptest.NewRequest(http.MethodGet, "/products/p1", nil)
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	if got := recorder.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "ETag") {
+		t.Fatalf("expected ETag to be exposed to browsers, got %q", got)
+	}
+
+	var product Product
+	if err := json.Unmarshal(recorder.Body.Bytes(), &product); err != nil {
+		t.Fatalf("failed to unmarshal product response: %v", err)
+	}
+	if product.ID != "p1" {
+		t.Fatalf("expected product p1 via registered /products/{id} route, got %q", product.ID)
+	}
+}
+
+func TestBuildServerHandler_SuggestRouteTakesPrecedenceOverProductID(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100, Brand: "apple"}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	handler := buildServerHandler(NewProductService(source, 30*time.Second), NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	request := httptest.NewRequest(http.MethodGet, "/products/suggest?q=ph", nil)
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	var payload SuggestionResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to unmarshal suggestion response: %v", err)
+	}
+	if len(payload.Products) != 1 || payload.Products[0].Text != "Phone" {
+		t.Fatalf("expected one Phone suggestion, got %+v", payload.Products)
+	}
+
+	missing := httptest.NewRecorder()
+	handler.ServeHTTP(missing, httptest.NewRequest(http.MethodGet, "/products/suggest", nil))
+	if missing.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without q, got %d", missing.Code)
+	}
+}
+
+type logBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+// entries decodes the JSON log lines whose msg equals message.
+func (b *logBuffer) entries(t *testing.T, message string) []map[string]any {
 	t.Helper()
 
-	origWriter := log.Writer()
-	origFlags := log.Flags()
-	origPrefix := log.Prefix()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		if entry["msg"] == message {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
 
-	buffer := &bytes.Buffer{}
-	log.SetOutput(buffer)
-	log.SetFlags(0)
-	log.SetPrefix("")
+func captureLogOutput(t *testing.T) *logBuffer {
+	t.Helper()
 
-	t.Cleanup(func() {
-		log.SetOutput(origWriter)
-		log.SetFlags(origFlags)
-		log.SetPrefix(origPrefix)
-	})
+	original := slog.Default()
+	buffer := &logBuffer{}
+	slog.SetDefault(newLogger(buffer, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(original) })
 
 	return buffer
 }
+
+func assertAccessLogged(t *testing.T, buffer *logBuffer, method string, path string) map[string]any {
+	t.Helper()
+
+	for _, entry := range buffer.entries(t, "http request") {
+		if entry["method"] == method && entry["path"] == path {
+			return entry
+		}
+	}
+	t.Fatalf("expected access log for %s %s, got %q", method, path, buffer.String())
+	return nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotLookupHit   = "hit"
+	snapshotLookupMiss  = "miss"
+	snapshotLookupStale = "stale"
+
+	sourceMetadata   = "metadata"
+	sourceDetails    = "details"
+	sourcePopularity = "popularity"
+	sourceOffers     = "offers"
+
+	unmatchedRoute = "unmatched"
+)
+
+var (
+	requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	loadDurationBuckets    = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+)
+
+// Metrics collects counters and histograms and renders them in the
+// Prometheus text exposition format. Methods are safe on a nil receiver so
+// the service can run without metrics.
+type Metrics struct {
+	mu              sync.Mutex
+	requests        map[requestSeries]*histogram
+	snapshotLookups map[string]uint64
+	loadDurations   map[string]*histogram
+	sourceErrors    map[string]uint64
+	violations      map[string]uint64
+}
+
+type requestSeries struct {
+	route  string
+	status string
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[requestSeries]*histogram),
+		snapshotLookups: map[string]uint64{
+			snapshotLookupHit:   0,
+			snapshotLookupMiss:  0,
+			snapshotLookupStale: 0,
+		},
+		loadDurations: make(map[string]*histogram),
+		sourceErrors: map[string]uint64{
+			sourceMetadata:   0,
+			sourceDetails:    0,
+			sourcePopularity: 0,
+			sourceOffers:     0,
+		},
+		violations: make(map[string]uint64),
+	}
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (m *Metrics) observeRequest(route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := requestSeries{route: route, status: strconv.Itoa(status)}
+	h, ok := m.requests[series]
+	if !ok {
+		h = newHistogram(requestDurationBuckets)
+		m.requests[series] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+func (m *Metrics) recordSnapshotLookup(outcome string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshotLookups[outcome]++
+}
+
+func (m *Metrics) observeSnapshotLoad(duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.loadDurations[result]
+	if !ok {
+		h = newHistogram(loadDurationBuckets)
+		m.loadDurations[result] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+func (m *Metrics) recordSourceError(source string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sourceErrors[source]++
+}
+
+func (m *Metrics) recordValidationViolations(rule string, count int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.violations[rule] += uint64(count)
+}
+
+func (m *Metrics) write(w io.Writer, service *ProductService) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requestKeys := make([]requestSeries, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	slices.SortFunc(requestKeys, func(a, b requestSeries) int {
+		if cmp := strings.Compare(a.route, b.route); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(a.status, b.status)
+	})
+
+	writeMetricHeader(w, "http_requests_total", "counter", "HTTP requests by route pattern and status code.")
+	for _, key := range requestKeys {
+		fmt.Fprintf(w, "http_requests_total%s %d\n", formatLabels("route", key.route, "status", key.status), m.requests[key].count)
+	}
+
+	writeMetricHeader(w, "http_request_duration_seconds", "histogram", "HTTP request latency by route pattern and status code.")
+	for _, key := range requestKeys {
+		writeHistogram(w, "http_request_duration_seconds", []string{"route", key.route, "status", key.status}, m.requests[key])
+	}
+
+	writeMetricHeader(w, "products_snapshot_lookups_total", "counter", "Snapshot lookups by outcome: fresh hit, miss that waited for a load, or stale snapshot served.")
+	for _, outcome := range sortedKeys(m.snapshotLookups) {
+		fmt.Fprintf(w, "products_snapshot_lookups_total%s %d\n", formatLabels("outcome", outcome), m.snapshotLookups[outcome])
+	}
+
+	writeMetricHeader(w, "products_snapshot_load_duration_seconds", "histogram", "Duration of snapshot loads by result.")
+	for _, result := range sortedKeys(m.loadDurations) {
+		writeHistogram(w, "products_snapshot_load_duration_seconds", []string{"result", result}, m.loadDurations[result])
+	}
+
+	writeMetricHeader(w, "products_source_errors_total", "counter", "Failed source loads by source.")
+	for _, source := range sortedKeys(m.sourceErrors) {
+		fmt.Fprintf(w, "products_source_errors_total%s %d\n", formatLabels("source", source), m.sourceErrors[source])
+	}
+
+	writeMetricHeader(w, "products_validation_violations_total", "counter", "Source record validation violations by rule.")
+	for _, rule := range sortedKeys(m.violations) {
+		fmt.Fprintf(w, "products_validation_violations_total%s %d\n", formatLabels("rule", rule), m.violations[rule])
+	}
+
+	if service == nil {
+		return
+	}
+	if state, ok := service.CacheState(); ok {
+		writeMetricHeader(w, "products_snapshot_products", "gauge", "Products in the current snapshot.")
+		fmt.Fprintf(w, "products_snapshot_products %d\n", state.productCount)
+		writeMetricHeader(w, "products_snapshot_age_seconds", "gauge", "Age of the current snapshot.")
+		fmt.Fprintf(w, "products_snapshot_age_seconds %s\n", formatFloat(state.age.Seconds()))
+	}
+	if report, ok := service.OrphanReport(); ok {
+		writeMetricHeader(w, "products_orphan_records", "gauge", "Source IDs skipped by the last snapshot build for lack of a matching record, by source.")
+		for _, source := range sortedKeys(report.Counts) {
+			fmt.Fprintf(w, "products_orphan_records%s %d\n", formatLabels("source", source), report.Counts[source])
+		}
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(w io.Writer, name string, labels []string, h *histogram) {
+	for i, bound := range h.buckets {
+		bucketLabels := append(slices.Clone(labels), "le", formatFloat(bound))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels...), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(append(slices.Clone(labels), "le", "+Inf")...), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labels...), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labels...), h.count)
+}
+
+func formatLabels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+escapeLabelValue(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func metricsHandler(metrics *Metrics, service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.write(w, service)
+	})
+}
+
+// withMetrics labels requests with the matched mux pattern rather than the
+// raw path, so product IDs do not create one series each.
+func withMetrics(next http.Handler, routes *http.ServeMux, metrics *Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		metrics.observeRequest(routePattern(routes, r), recorder.status, time.Since(start))
+	})
+}
+
+func routePattern(routes *http.ServeMux, r *http.Request) string {
+	if _, pattern := routes.Handler(r); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
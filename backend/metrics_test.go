@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrapeMetrics(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected metrics status 200, got %d", recorder.Code)
+	}
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Fatalf("expected Prometheus text content type, got %q", got)
+	}
+	return recorder.Body.String()
+}
+
+func assertMetricLine(t *testing.T, body string, line string) {
+	t.Helper()
+	for _, candidate := range strings.Split(body, "\n") {
+		if candidate == line {
+			return
+		}
+	}
+	t.Fatalf("expected metric line %q in:\n%s", line, body)
+}
+
+func TestMetricsEndpoint_ExposesRequestAndSnapshotSeries(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}, {ID: "p2", Name: "Laptop", BasePrice: 900}},
+		details:  []DetailsRecord{{ID: "p1"}, {ID: "p2"}},
+	}
+	metrics := NewMetrics()
+	service := NewProductService(source, 30*time.Second).WithMetrics(metrics)
+	handler := buildServerHandler(service, metrics, serverConfig{CORSAllowOrigin: "*"})
+
+	for _, target := range []string{"/products", "/products/p1", "/products/p2", "/products/missing", "/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	body := scrapeMetrics(t, handler)
+
+	assertMetricLine(t, body, `http_requests_total{route="/products",status="200"} 1`)
+	assertMetricLine(t, body, `http_requests_total{route="/products/{id}",status="200"} 2`)
+	assertMetricLine(t, body, `http_requests_total{route="/products/{id}",status="404"} 1`)
+	assertMetricLine(t, body, `http_requests_total{route="unmatched",status="404"} 1`)
+	assertMetricLine(t, body, `http_request_duration_seconds_count{route="/products/{id}",status="200"} 2`)
+	assertMetricLine(t, body, `http_request_duration_seconds_bucket{route="/products",status="200",le="+Inf"} 1`)
+	assertMetricLine(t, body, `products_snapshot_lookups_total{outcome="miss"} 1`)
+	assertMetricLine(t, body, `products_snapshot_lookups_total{outcome="hit"} 3`)
+	assertMetricLine(t, body, `products_snapshot_lookups_total{outcome="stale"} 0`)
+	assertMetricLine(t, body, `products_snapshot_load_duration_seconds_count{result="success"} 1`)
+	assertMetricLine(t, body, `products_source_errors_total{source="details"} 0`)
+	assertMetricLine(t, body, `products_snapshot_products 2`)
+	if !strings.Contains(body, "# TYPE http_request_duration_seconds histogram") {
+		t.Fatalf("expected histogram type header, got:\n%s", body)
+	}
+	if !strings.Contains(body, "products_snapshot_age_seconds ") {
+		t.Fatalf("expected snapshot age gauge, got:\n%s", body)
+	}
+}
+
+func TestMetrics_CountsSourceErrorsAndStaleServes(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	metrics := NewMetrics()
+	now := time.Date(2026, 2, 24, 19, 0, 0, 0, time.UTC)
+	service := NewProductService(source, 30*time.Second).
+		WithMetrics(metrics).
+		WithPopularitySource(&fakePopularitySource{err: errors.New("popularity down")})
+	service.now = func() time.Time { return now }
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("first query unexpected error: %v", err)
+	}
+
+	source.setErr(errors.New("metadata down"))
+	now = now.Add(31 * time.Second)
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("stale query unexpected error: %v", err)
+	}
+	waitForBackgroundRefresh(t, service)
+
+	body := scrapeMetrics(t, metricsHandler(metrics, service))
+
+	assertMetricLine(t, body, `products_snapshot_lookups_total{outcome="stale"} 1`)
+	assertMetricLine(t, body, `products_source_errors_total{source="metadata"} 1`)
+	assertMetricLine(t, body, `products_source_errors_total{source="popularity"} 1`)
+	assertMetricLine(t, body, `products_snapshot_load_duration_seconds_count{result="error"} 1`)
+	assertMetricLine(t, body, `products_snapshot_age_seconds 31`)
+}
+
+func TestFormatLabels_EscapesValues(t *testing.T) {
+	got := formatLabels("route", "a\"b\\c\nd")
+	if got != `{route="a\"b\\c\nd"}` {
+		t.Fatalf("unexpected escaped labels %s", got)
+	}
+}
@@ -25,10 +25,31 @@ type PopularityRecord struct {
 	Rank int    `json:"rank"`
 }
 
+// OfferRecord is one merchant's listing of a product.
+type OfferRecord struct {
+	ID             string  `json:"id"`
+	ProductID      string  `json:"product_id"`
+	Merchant       string  `json:"merchant"`
+	Price          float64 `json:"price"`
+	Condition      string  `json:"condition"`
+	Stock          int     `json:"stock"`
+	WarrantyMonths int     `json:"warranty_months"`
+}
+
+type Offer struct {
+	ID             string  `json:"id"`
+	Merchant       string  `json:"merchant"`
+	Price          float64 `json:"price"`
+	Condition      string  `json:"condition"`
+	Stock          int     `json:"stock"`
+	WarrantyMonths int     `json:"warranty_months"`
+}
+
 type Product struct {
 	ID               string            `json:"id"`
 	Name             string            `json:"name"`
 	Price            float64           `json:"price"`
+	LowestPrice30d   float64           `json:"lowest_price_30d"`
 	DiscountPercent  int               `json:"discount_percent"`
 	Bestseller       bool              `json:"bestseller"`
 	Colors           []string          `json:"colors"`
@@ -40,18 +61,58 @@ type Product struct {
 	Brand            string            `json:"brand"`
 	Condition        string            `json:"condition"`
 	PopularityRank   int               `json:"popularity_rank,omitempty"`
+	// Offers are ordered by the best-offer policy, best first. When present,
+	// the best offer sets Price, Stock and Condition.
+	Offers      []Offer `json:"offers,omitempty"`
+	BestOfferID string  `json:"best_offer_id,omitempty"`
+
+	relevance float64
 }
 
 type ProductListResponse struct {
-	Items           []Product `json:"items"`
-	Total           int       `json:"total"`
-	Limit           int       `json:"limit"`
-	Offset          int       `json:"offset"`
-	HasMore         bool      `json:"has_more"`
-	AvailableColors []string  `json:"available_colors"`
-	AvailableBrands []string  `json:"available_brands"`
-	PriceMin        float64   `json:"price_min"`
-	PriceMax        float64   `json:"price_max"`
+	Items           []Product     `json:"items"`
+	Total           int           `json:"total"`
+	Limit           int           `json:"limit"`
+	Offset          int           `json:"offset"`
+	HasMore         bool          `json:"has_more"`
+	NextCursor      string        `json:"next_cursor,omitempty"`
+	AvailableColors []string      `json:"available_colors"`
+	AvailableBrands []string      `json:"available_brands"`
+	PriceMin        float64       `json:"price_min"`
+	PriceMax        float64       `json:"price_max"`
+	Facets          ProductFacets `json:"facets"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type ProductFacets struct {
+	Colors     []FacetValue `json:"colors"`
+	Brands     []FacetValue `json:"brands"`
+	Categories []FacetValue `json:"categories"`
+	Conditions []FacetValue `json:"conditions"`
+	Bestseller []FacetValue `json:"bestseller"`
+	OnSale     []FacetValue `json:"on_sale"`
+}
+
+type SuggestionResponse struct {
+	Query      string       `json:"query"`
+	Products   []Suggestion `json:"products"`
+	Brands     []Suggestion `json:"brands"`
+	Categories []Suggestion `json:"categories"`
+}
+
+type Suggestion struct {
+	Text       string           `json:"text"`
+	ProductID  string           `json:"product_id,omitempty"`
+	Highlights []HighlightRange `json:"highlights"`
+}
+
+type HighlightRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 type errorResponse struct {
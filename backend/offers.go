@@ -0,0 +1,161 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// BestOfferPolicy decides which offer of a product is the headline offer.
+// Every policy prefers offers in stock and breaks its remaining ties by
+// offer ID, so the choice is deterministic.
+type BestOfferPolicy string
+
+const (
+	// BestOfferLowestPrice picks the cheapest offer, then the longest
+	// warranty.
+	BestOfferLowestPrice BestOfferPolicy = "lowest_price"
+	// BestOfferBestCondition picks the best condition (new, refurbished,
+	// used, then unknown), then the cheapest offer.
+	BestOfferBestCondition BestOfferPolicy = "best_condition"
+	// BestOfferLongestWarranty picks the longest warranty, then the cheapest
+	// offer.
+	BestOfferLongestWarranty BestOfferPolicy = "longest_warranty"
+
+	DefaultBestOfferPolicy = BestOfferLowestPrice
+)
+
+var bestOfferPolicies = []BestOfferPolicy{BestOfferLowestPrice, BestOfferBestCondition, BestOfferLongestWarranty}
+
+func parseBestOfferPolicy(raw string) (BestOfferPolicy, error) {
+	policy := BestOfferPolicy(strings.ToLower(strings.TrimSpace(raw)))
+	if slices.Contains(bestOfferPolicies, policy) {
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown best-offer policy %q (want lowest_price, best_condition or longest_warranty)", raw)
+}
+
+// compare orders offers best first.
+func (p BestOfferPolicy) compare(a, b Offer) int {
+	if inStock := cmp.Compare(min(b.Stock, 1), min(a.Stock, 1)); inStock != 0 {
+		return inStock
+	}
+	byPrice := cmp.Compare(priceCents(a.Price), priceCents(b.Price))
+	var order int
+	switch p {
+	case BestOfferBestCondition:
+		order = cmp.Or(cmp.Compare(conditionRank(a.Condition), conditionRank(b.Condition)), byPrice)
+	case BestOfferLongestWarranty:
+		order = cmp.Or(cmp.Compare(b.WarrantyMonths, a.WarrantyMonths), byPrice)
+	default:
+		order = cmp.Or(byPrice, cmp.Compare(b.WarrantyMonths, a.WarrantyMonths))
+	}
+	return cmp.Or(order, strings.Compare(a.ID, b.ID))
+}
+
+// conditionRank orders knownConditions from best to worst; unknown or
+// missing conditions rank last.
+func conditionRank(condition string) int {
+	if rank := slices.Index(knownConditions, condition); rank >= 0 {
+		return rank
+	}
+	return len(knownConditions)
+}
+
+// groupOffers indexes validated offer records by product ID. Offer IDs must
+// be unique across the source.
+func groupOffers(records []OfferRecord) (map[string][]Offer, error) {
+	offers := make(map[string][]Offer)
+	seen := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		id := strings.TrimSpace(record.ID)
+		if _, exists := seen[id]; exists {
+			return nil, fmt.Errorf("offers contain duplicate id %q", id)
+		}
+		seen[id] = struct{}{}
+
+		productID := strings.TrimSpace(record.ProductID)
+		offers[productID] = append(offers[productID], Offer{
+			ID:             id,
+			Merchant:       strings.TrimSpace(record.Merchant),
+			Price:          float64(priceCents(record.Price)) / 100,
+			Condition:      normalizeToken(record.Condition),
+			Stock:          max(0, record.Stock),
+			WarrantyMonths: max(0, record.WarrantyMonths),
+		})
+	}
+	return offers, nil
+}
+
+// applyOffers attaches each product's offers in policy order and lets the
+// best one set the headline price, stock and condition. The discount is
+// recomputed against the metadata base price so on-sale filtering follows
+// the headline price. Offers carry no colors, so the details stock per
+// color is dropped; stock filters then use the offer stock for every color.
+// Products without offers keep their details values.
+// It returns the IDs of offers that match no product, sorted.
+func applyOffers(products []Product, basePrices map[string]float64, offers map[string][]Offer, policy BestOfferPolicy) []string {
+	matched := make(map[string]struct{}, len(products))
+	for i := range products {
+		products[i].Offers = nil
+		products[i].BestOfferID = ""
+		productOffers := offers[products[i].ID]
+		if len(productOffers) == 0 {
+			continue
+		}
+		matched[products[i].ID] = struct{}{}
+
+		productOffers = slices.Clone(productOffers)
+		slices.SortFunc(productOffers, policy.compare)
+		best := productOffers[0]
+		products[i].Offers = productOffers
+		products[i].BestOfferID = best.ID
+		products[i].Price = best.Price
+		products[i].Stock = best.Stock
+		products[i].StockByColor = nil
+		products[i].Condition = best.Condition
+		products[i].DiscountPercent = offerDiscountPercent(basePrices[products[i].ID], best.Price)
+	}
+
+	var orphans []string
+	for productID, productOffers := range offers {
+		if _, ok := matched[productID]; ok {
+			continue
+		}
+		for _, offer := range productOffers {
+			orphans = append(orphans, offer.ID)
+		}
+	}
+	slices.Sort(orphans)
+	return orphans
+}
+
+func basePrices(metadata []MetadataRecord) map[string]float64 {
+	prices := make(map[string]float64, len(metadata))
+	for _, record := range metadata {
+		prices[strings.TrimSpace(record.ID)] = record.BasePrice
+	}
+	return prices
+}
+
+// offerDiscountPercent is how far price is below basePrice, rounded to a
+// whole percent. Offers above the base price are not discounted.
+func offerDiscountPercent(basePrice, price float64) int {
+	baseCents := priceCents(basePrice)
+	if baseCents <= 0 {
+		return 0
+	}
+	saved := baseCents - priceCents(price)
+	if saved <= 0 {
+		return 0
+	}
+	return clampPercent(int((saved*100 + baseCents/2) / baseCents))
+}
+
+func cloneOffers(offers []Offer) []Offer {
+	if offers == nil {
+		return nil
+	}
+	return slices.Clone(offers)
+}
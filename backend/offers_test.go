@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBestOfferPolicies(t *testing.T) {
+	offers := []Offer{
+		{ID: "cheap-used", Price: 200, Condition: "used", Stock: 5, WarrantyMonths: 6},
+		{ID: "sold-out", Price: 100, Condition: "new", Stock: 0, WarrantyMonths: 36},
+		{ID: "new", Price: 300, Condition: "new", Stock: 1, WarrantyMonths: 24},
+		{ID: "refurb-a", Price: 250, Condition: "refurbished", Stock: 2, WarrantyMonths: 24},
+		{ID: "refurb-b", Price: 200, Condition: "refurbished", Stock: 2, WarrantyMonths: 12},
+	}
+	for policy, want := range map[BestOfferPolicy][]string{
+		BestOfferLowestPrice:     {"refurb-b", "cheap-used", "refurb-a", "new", "sold-out"},
+		BestOfferBestCondition:   {"new", "refurb-b", "refurb-a", "cheap-used", "sold-out"},
+		BestOfferLongestWarranty: {"refurb-a", "new", "refurb-b", "cheap-used", "sold-out"},
+	} {
+		sorted := slices.Clone(offers)
+		slices.SortFunc(sorted, policy.compare)
+		var got []string
+		for _, offer := range sorted {
+			got = append(got, offer.ID)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: expected order %v, got %v", policy, want, got)
+		}
+	}
+
+	if policy, err := parseBestOfferPolicy(" Best_Condition "); err != nil || policy != BestOfferBestCondition {
+		t.Fatalf("expected best_condition, got %q (%v)", policy, err)
+	}
+	if _, err := parseBestOfferPolicy("cheapest"); err == nil || !strings.Contains(err.Error(), "unknown best-offer policy") {
+		t.Fatalf("expected unknown policy error, got %v", err)
+	}
+}
+
+func newOfferTestService(offers *fakeOfferSource, policy BestOfferPolicy) *ProductService {
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Phone", BasePrice: 400, ImageURL: "https://img.example/p1.jpg", Category: "phones", Brand: "acme"},
+			{ID: "p2", Name: "Tablet", BasePrice: 300, ImageURL: "https://img.example/p2.jpg", Category: "tablets", Brand: "acme"},
+		},
+		details: []DetailsRecord{
+			{ID: "p1", DiscountPercent: 10, Stock: 7, Condition: "new"},
+			{ID: "p2", DiscountPercent: 0, Stock: 3, Condition: "refurbished"},
+		},
+	}
+	return NewProductService(source, 30*time.Second).WithOfferSource(offers, policy)
+}
+
+func TestProductService_BestOfferDrivesHeadlineFields(t *testing.T) {
+	captureLogOutput(t)
+	offers := &fakeOfferSource{records: []OfferRecord{
+		{ID: "o1", ProductID: "p1", Merchant: "A", Price: 350, Condition: "New", Stock: 2, WarrantyMonths: 24},
+		{ID: "o2", ProductID: "p1", Merchant: "B", Price: 250.004, Condition: "used", Stock: 4, WarrantyMonths: 6},
+		{ID: "o3", ProductID: "p1", Merchant: "C", Price: 199, Condition: "used", Stock: 0, WarrantyMonths: 0},
+		{ID: "o4", ProductID: "gone", Merchant: "D", Price: 10, Condition: "used", Stock: 1},
+		{ID: "o5", ProductID: "p2", Merchant: "E", Price: -5, Condition: "used", Stock: 1},
+	}}
+	service := newOfferTestService(offers, "")
+
+	product, _, err := service.GetProduct(context.Background(), "p1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if product.BestOfferID != "o2" || product.Price != 250 || product.Stock != 4 || product.Condition != "used" || product.DiscountPercent != 38 {
+		t.Fatalf("expected the cheapest in-stock offer to set the headline, got %+v", product)
+	}
+	if len(product.Offers) != 3 || product.Offers[0].ID != "o2" || product.Offers[2].ID != "o3" || product.Offers[1].Condition != "new" {
+		t.Fatalf("expected offers in policy order, got %+v", product.Offers)
+	}
+
+	// p2's only offer fails validation, so it keeps its details values.
+	other, _, err := service.GetProduct(context.Background(), "p2")
+	if err != nil || other.Price != 300 || other.Stock != 3 || other.Condition != "refurbished" || other.Offers != nil {
+		t.Fatalf("expected p2 to keep its details values, got %+v (%v)", other, err)
+	}
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{Conditions: []string{"used"}, Sort: SortPriceAsc})
+	if err != nil || response.Total != 1 || response.Items[0].ID != "p1" {
+		t.Fatalf("expected filters to use the headline condition, got %+v (%v)", response.Items, err)
+	}
+
+	report, ok := service.OrphanReport()
+	if !ok || !slices.Equal(report.Offers, []string{"o4"}) || report.Counts[sourceOffers] != 1 {
+		t.Fatalf("expected the unmatched offer to be reported, got %+v", report)
+	}
+	quality, ok := service.DataQualityReport()
+	if !ok || quality.RecordsChecked[sourceOffers] != 5 || quality.RecordsRejected[sourceOffers] != 1 || quality.ViolationCounts["offers.price.range"] != 1 {
+		t.Fatalf("expected the invalid offer to be rejected by validation, got %+v", quality)
+	}
+
+	if source := service.Readiness().Sources[sourceOffers]; source.LastSuccess == nil || source.Stale {
+		t.Fatalf("expected offers in readiness, got %+v", source)
+	}
+}
+
+func TestProductService_BestOfferPolicyIsConfigurable(t *testing.T) {
+	captureLogOutput(t)
+	offers := &fakeOfferSource{records: []OfferRecord{
+		{ID: "o1", ProductID: "p1", Merchant: "A", Price: 380, Condition: "new", Stock: 1, WarrantyMonths: 12},
+		{ID: "o2", ProductID: "p1", Merchant: "B", Price: 300, Condition: "refurbished", Stock: 1, WarrantyMonths: 36},
+	}}
+
+	product, _, err := newOfferTestService(offers, BestOfferBestCondition).GetProduct(context.Background(), "p1")
+	if err != nil || product.BestOfferID != "o1" || product.Price != 380 || product.DiscountPercent != 5 {
+		t.Fatalf("expected the new offer under best_condition, got %+v (%v)", product, err)
+	}
+	product, _, err = newOfferTestService(offers, BestOfferLongestWarranty).GetProduct(context.Background(), "p1")
+	if err != nil || product.BestOfferID != "o2" || product.Condition != "refurbished" {
+		t.Fatalf("expected the 36-month offer under longest_warranty, got %+v (%v)", product, err)
+	}
+}
+
+func TestProductService_OfferStockReplacesStockByColor(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Phone", BasePrice: 400, ImageURL: "https://img.example/p1.jpg", Category: "phones", Brand: "acme"},
+			{ID: "p2", Name: "Tablet", BasePrice: 300, ImageURL: "https://img.example/p2.jpg", Category: "tablets", Brand: "acme"},
+		},
+		details: []DetailsRecord{
+			{ID: "p1", Stock: 8, Condition: "new", Colors: []string{"black", "white"}, StockByColor: map[string]int{"black": 5, "white": 3}},
+			{ID: "p2", Stock: 2, Condition: "new", Colors: []string{"silver"}, StockByColor: map[string]int{"silver": 2}},
+		},
+	}
+	offers := &fakeOfferSource{records: []OfferRecord{
+		{ID: "o1", ProductID: "p1", Merchant: "A", Price: 350, Condition: "new", Stock: 0},
+	}}
+	service := NewProductService(source, 30*time.Second).WithOfferSource(offers, "")
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{})
+
+	var list ProductListResponse
+	recorder := serveWithEncoding(handler, "/products?inStock=true", "")
+	if err := json.Unmarshal(recorder.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid products response %q: %v", recorder.Body.String(), err)
+	}
+	if list.Total != 1 || list.Items[0].ID != "p2" {
+		t.Fatalf("expected the sold-out offer to take p1 out of stock, got %+v", list.Items)
+	}
+	if !slices.Equal(list.AvailableColors, []string{"silver"}) {
+		t.Fatalf("expected p1's colors to follow the offer stock, got %v", list.AvailableColors)
+	}
+	if recorder := serveWithEncoding(handler, "/products?color=black&minStock=1", ""); !strings.Contains(recorder.Body.String(), `"total":0`) {
+		t.Fatalf("expected no black stock from the sold-out offer, got %q", recorder.Body.String())
+	}
+
+	recorder = serveWithEncoding(handler, "/products/p1", "")
+	if body := recorder.Body.String(); !strings.Contains(body, `"stock":0`) || !strings.Contains(body, `"stock_by_color":null`) {
+		t.Fatalf("expected the offer stock without the details color breakdown, got %q", body)
+	}
+	if product, _, _ := service.GetProduct(context.Background(), "p2"); product.StockByColor["silver"] != 2 {
+		t.Fatalf("expected products without offers to keep stock_by_color, got %+v", product.StockByColor)
+	}
+}
+
+func TestProductService_OfferFailuresKeepDetailsValues(t *testing.T) {
+	logs := captureLogOutput(t)
+
+	for name, offers := range map[string]*fakeOfferSource{
+		"load failure": {err: errors.New("offers unavailable")},
+		"duplicate id": {records: []OfferRecord{
+			{ID: "o1", ProductID: "p1", Merchant: "A", Price: 100, Condition: "used", Stock: 1},
+			{ID: "o1", ProductID: "p2", Merchant: "B", Price: 100, Condition: "used", Stock: 1},
+		}},
+	} {
+		service := newOfferTestService(offers, "")
+		snapshot, err := service.refreshSnapshot(context.Background())
+		if err != nil {
+			t.Fatalf("%s: expected offers to be optional, got %v", name, err)
+		}
+		if product := snapshot.products[0]; product.Price != 360 || product.Stock != 7 || product.Offers != nil {
+			t.Fatalf("%s: expected details values, got %+v", name, product)
+		}
+		if len(snapshot.warnings) != 1 || !strings.Contains(snapshot.warnings[0], "offers") {
+			t.Fatalf("%s: expected one offers warning, got %v", name, snapshot.warnings)
+		}
+		if source := service.Readiness().Sources[sourceOffers]; source.LastError == "" || source.Stale {
+			t.Fatalf("%s: expected a failing, non-stale offers source, got %+v", name, source)
+		}
+	}
+	if entries := logs.entries(t, "offers source load failed, continuing without offers"); len(entries) != 1 {
+		t.Fatalf("expected one load failure log, got %d", len(entries))
+	}
+}
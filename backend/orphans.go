@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+const (
+	maxReportedOrphans = 500
+	orphanLogSample    = 10
+)
+
+// orphanIDs lists source IDs that did not make it into the snapshot because
+// the other side of the join is missing.
+type orphanIDs struct {
+	// metadata holds metadata IDs without a details record.
+	metadata []string
+	// details holds details IDs without a metadata record.
+	details []string
+	// popularity holds ranked IDs that match no merged product.
+	popularity []string
+	// offers holds offer IDs whose product ID matches no merged product.
+	offers []string
+}
+
+// OrphanReport is the orphan summary of the last local snapshot build. Each
+// list holds up to 500 sorted IDs; Counts always has the full numbers.
+type OrphanReport struct {
+	CheckedAt  time.Time      `json:"checked_at"`
+	Counts     map[string]int `json:"counts"`
+	Metadata   []string       `json:"metadata"`
+	Details    []string       `json:"details"`
+	Popularity []string       `json:"popularity"`
+	Offers     []string       `json:"offers"`
+	Truncated  bool           `json:"truncated"`
+}
+
+func newOrphanReport(checkedAt time.Time, orphans orphanIDs) *OrphanReport {
+	report := &OrphanReport{
+		CheckedAt: checkedAt,
+		Counts: map[string]int{
+			sourceMetadata:   len(orphans.metadata),
+			sourceDetails:    len(orphans.details),
+			sourcePopularity: len(orphans.popularity),
+			sourceOffers:     len(orphans.offers),
+		},
+	}
+	report.Metadata = report.limit(orphans.metadata)
+	report.Details = report.limit(orphans.details)
+	report.Popularity = report.limit(orphans.popularity)
+	report.Offers = report.limit(orphans.offers)
+	return report
+}
+
+func (r *OrphanReport) limit(ids []string) []string {
+	if len(ids) > maxReportedOrphans {
+		r.Truncated = true
+		ids = ids[:maxReportedOrphans]
+	}
+	return append([]string{}, ids...)
+}
+
+func (r *OrphanReport) total() int {
+	return r.Counts[sourceMetadata] + r.Counts[sourceDetails] + r.Counts[sourcePopularity] + r.Counts[sourceOffers]
+}
+
+func (r *OrphanReport) clone() OrphanReport {
+	cloned := *r
+	cloned.Counts = maps.Clone(r.Counts)
+	cloned.Metadata = slices.Clone(r.Metadata)
+	cloned.Details = slices.Clone(r.Details)
+	cloned.Popularity = slices.Clone(r.Popularity)
+	cloned.Offers = slices.Clone(r.Offers)
+	return cloned
+}
+
+func (s *ProductService) recordOrphans(ctx context.Context, orphans orphanIDs) {
+	report := newOrphanReport(s.now(), orphans)
+
+	s.diagnosticsMu.Lock()
+	s.orphanReport = report
+	s.diagnosticsMu.Unlock()
+
+	if report.total() == 0 {
+		return
+	}
+	slog.WarnContext(ctx, "orphaned source records skipped",
+		"metadata", report.Counts[sourceMetadata],
+		"details", report.Counts[sourceDetails],
+		"popularity", report.Counts[sourcePopularity],
+		"offers", report.Counts[sourceOffers],
+		"metadata_sample", orphanSample(orphans.metadata),
+		"details_sample", orphanSample(orphans.details),
+		"popularity_sample", orphanSample(orphans.popularity),
+		"offers_sample", orphanSample(orphans.offers),
+	)
+}
+
+func orphanSample(ids []string) []string {
+	return ids[:min(len(ids), orphanLogSample)]
+}
+
+// OrphanReport returns the orphans found by the last local snapshot build.
+func (s *ProductService) OrphanReport() (OrphanReport, bool) {
+	s.diagnosticsMu.Lock()
+	defer s.diagnosticsMu.Unlock()
+	if s.orphanReport == nil {
+		return OrphanReport{}, false
+	}
+	return s.orphanReport.clone(), true
+}
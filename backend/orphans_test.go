@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeProducts_ReturnsOrphanIDs(t *testing.T) {
+	products, orphans, err := mergeProducts(
+		[]MetadataRecord{{ID: "p3", Name: "C", BasePrice: 1}, {ID: "p1", Name: "A", BasePrice: 1}, {ID: " p2 ", Name: "B", BasePrice: 1}},
+		[]DetailsRecord{{ID: "p2"}, {ID: "d9"}, {ID: "d8"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(products) != 1 || products[0].ID != "p2" {
+		t.Fatalf("expected only p2 to merge, got %+v", products)
+	}
+	if strings.Join(orphans.metadata, ",") != "p1,p3" || strings.Join(orphans.details, ",") != "d8,d9" {
+		t.Fatalf("expected sorted orphans, got metadata=%v details=%v", orphans.metadata, orphans.details)
+	}
+
+	unmatched := applyPopularityRanks(products, map[string]int{"p2": 1, "p1": 2, "x": 3})
+	if strings.Join(unmatched, ",") != "p1,x" || products[0].PopularityRank != 1 {
+		t.Fatalf("expected unmatched popularity IDs p1,x, got %v", unmatched)
+	}
+}
+
+func TestProductService_ReportsOrphans(t *testing.T) {
+	logs := captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}, {ID: "meta-only", Name: "Ghost", BasePrice: 10}},
+		details:  []DetailsRecord{{ID: "p1"}, {ID: "details-only"}},
+	}
+	popularity := &fakePopularitySource{records: []PopularityRecord{{ID: "p1", Rank: 1}, {ID: "retired", Rank: 2}}}
+	metrics := NewMetrics()
+	service := NewProductService(source, 30*time.Second).WithPopularitySource(popularity).WithMetrics(metrics)
+	handler := buildServerHandler(service, metrics, serverConfig{CORSAllowOrigin: "*", AdminToken: testAdminToken})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/orphans"))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the first build, got %d", recorder.Code)
+	}
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/orphans"))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	var report OrphanReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report JSON: %v", err)
+	}
+	if strings.Join(report.Metadata, ",") != "meta-only" || strings.Join(report.Details, ",") != "details-only" || strings.Join(report.Popularity, ",") != "retired" {
+		t.Fatalf("unexpected orphan report: %+v", report)
+	}
+	if report.Counts[sourceMetadata] != 1 || report.Truncated {
+		t.Fatalf("unexpected orphan counts: %+v", report)
+	}
+
+	entries := logs.entries(t, "orphaned source records skipped")
+	if len(entries) != 1 || entries[0]["details"] != float64(1) || fmt.Sprint(entries[0]["popularity_sample"]) != "[retired]" {
+		t.Fatalf("expected one orphan summary log, got %v", entries)
+	}
+
+	body := scrapeMetrics(t, handler)
+	assertMetricLine(t, body, `products_orphan_records{source="popularity"} 1`)
+}
+
+func TestOrphanReport_TruncatesLists(t *testing.T) {
+	ids := make([]string, maxReportedOrphans+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("p%04d", i)
+	}
+	report := newOrphanReport(time.Now(), orphanIDs{details: ids})
+	if !report.Truncated || len(report.Details) != maxReportedOrphans || report.Counts[sourceDetails] != len(ids) {
+		t.Fatalf("expected truncated details list with full count, got truncated=%v listed=%d count=%d", report.Truncated, len(report.Details), report.Counts[sourceDetails])
+	}
+	if report.Metadata == nil || len(report.Metadata) != 0 {
+		t.Fatalf("expected empty (not null) metadata list, got %v", report.Metadata)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// priceReferenceWindow is the EU Omnibus look-back: a price reduction
+	// must show the lowest price of the 30 days before it.
+	priceReferenceWindow = 30 * 24 * time.Hour
+	// priceHistoryRetention bounds the stored history and the range served
+	// by /products/{id}/price-history.
+	priceHistoryRetention = 90 * 24 * time.Hour
+
+	// priceHistoryCompactEvery is how often observe drops points past
+	// retention, from memory and from the file.
+	priceHistoryCompactEvery = 24 * time.Hour
+
+	defaultPriceHistoryDays = 30
+	maxPriceHistoryDays     = int(priceHistoryRetention / (24 * time.Hour))
+)
+
+// PricePoint is a price that took effect at At and held until the next
+// point of the same product.
+type PricePoint struct {
+	Price float64   `json:"price"`
+	At    time.Time `json:"at"`
+}
+
+// PriceHistoryResponse is the price series of one product, oldest first. The
+// first point may predate the requested range when that price was still in
+// effect at its start.
+type PriceHistoryResponse struct {
+	ProductID      string       `json:"product_id"`
+	Price          float64      `json:"price"`
+	LowestPrice30d float64      `json:"lowest_price_30d"`
+	Days           int          `json:"days"`
+	Points         []PricePoint `json:"points"`
+}
+
+// priceRecord is one line of the history file.
+type priceRecord struct {
+	ID    string    `json:"id"`
+	Price float64   `json:"price"`
+	At    time.Time `json:"at"`
+}
+
+// PriceHistory remembers product price changes across snapshot builds. With
+// a path, changes are appended to a JSON Lines file and replayed at startup;
+// without one, the history lives only as long as the process.
+type PriceHistory struct {
+	path string
+
+	mu          sync.Mutex
+	series      map[string][]PricePoint
+	file        *os.File
+	compactedAt time.Time
+}
+
+func newMemoryPriceHistory() *PriceHistory {
+	return &PriceHistory{series: make(map[string][]PricePoint)}
+}
+
+// OpenPriceHistory replays the file at path, dropping points that fell out
+// of retention, and keeps it open for appending. A torn last line from an
+// interrupted write is skipped.
+func OpenPriceHistory(path string, now time.Time) (*PriceHistory, error) {
+	history := &PriceHistory{path: path, series: make(map[string][]PricePoint)}
+	loaded, skipped, err := history.replay()
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		slog.Warn("price history records skipped", "path", path, "skipped", skipped)
+	}
+	history.compactedAt = now
+	if dropped := history.prune(now.Add(-priceHistoryRetention)); dropped > 0 || skipped > 0 {
+		if err := history.rewrite(); err != nil {
+			return nil, err
+		}
+		slog.Info("price history compacted", "path", path, "loaded", loaded, "dropped", dropped)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open price history: %w", err)
+	}
+	history.file = file
+	return history, nil
+}
+
+func (h *PriceHistory) replay() (loaded, skipped int, err error) {
+	file, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("open price history: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record priceRecord
+		if err := json.Unmarshal(line, &record); err != nil || record.ID == "" || record.At.IsZero() {
+			skipped++
+			continue
+		}
+		h.append(record.ID, PricePoint{Price: record.Price, At: record.At})
+		loaded++
+	}
+	if err := scanner.Err(); err != nil {
+		return loaded, skipped, fmt.Errorf("read price history: %w", err)
+	}
+	return loaded, skipped, nil
+}
+
+// append adds a point unless it repeats the current price or predates the
+// last change, which happens when an older shared snapshot is adopted.
+func (h *PriceHistory) append(id string, point PricePoint) bool {
+	points := h.series[id]
+	if len(points) > 0 {
+		last := points[len(points)-1]
+		if priceCents(last.Price) == priceCents(point.Price) || point.At.Before(last.At) {
+			return false
+		}
+	}
+	h.series[id] = append(points, point)
+	return true
+}
+
+// prune drops points that ended before cutoff. The point in effect at the
+// cutoff is kept, since it still counts towards the window.
+func (h *PriceHistory) prune(cutoff time.Time) int {
+	dropped := 0
+	for id, points := range h.series {
+		first := 0
+		for first+1 < len(points) && !points[first+1].At.After(cutoff) {
+			first++
+		}
+		if first > 0 {
+			h.series[id] = append([]PricePoint(nil), points[first:]...)
+			dropped += first
+		}
+	}
+	return dropped
+}
+
+// rewrite replaces the file with the retained points through a temporary
+// file and a rename, so a crash leaves either the old or the new history.
+func (h *PriceHistory) rewrite() error {
+	temp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("compact price history: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	var records bytes.Buffer
+	for _, id := range sortedKeys(h.series) {
+		for _, point := range h.series[id] {
+			if err := appendPriceRecord(&records, id, point); err != nil {
+				temp.Close()
+				return fmt.Errorf("compact price history: %w", err)
+			}
+		}
+	}
+	if _, err := temp.Write(records.Bytes()); err != nil {
+		temp.Close()
+		return fmt.Errorf("compact price history: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return fmt.Errorf("compact price history: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("compact price history: %w", err)
+	}
+	if err := os.Rename(temp.Name(), h.path); err != nil {
+		return fmt.Errorf("compact price history: %w", err)
+	}
+	return nil
+}
+
+// compact drops points past retention as of now. With a file, it rewrites
+// the file without them and reopens it for appending.
+func (h *PriceHistory) compact(now time.Time) error {
+	h.compactedAt = now
+	dropped := h.prune(now.Add(-priceHistoryRetention))
+	if dropped == 0 || h.file == nil {
+		return nil
+	}
+	if err := h.rewrite(); err != nil {
+		return err
+	}
+	// The append handle still points at the replaced file.
+	_ = h.file.Close()
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		h.file = nil
+		return fmt.Errorf("open price history: %w", err)
+	}
+	h.file = file
+	slog.Info("price history compacted", "path", h.path, "dropped", dropped)
+	return nil
+}
+
+func appendPriceRecord(records *bytes.Buffer, id string, point PricePoint) error {
+	line, err := json.Marshal(priceRecord{ID: id, Price: point.Price, At: point.At.UTC()})
+	if err != nil {
+		return err
+	}
+	records.Write(line)
+	records.WriteByte('\n')
+	return nil
+}
+
+// observe records the products' prices as of at. Only changes are stored,
+// and they are appended to the file in one synced write. Once a day it also
+// compacts the history.
+func (h *PriceHistory) observe(products []Product, at time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var records bytes.Buffer
+	for _, product := range products {
+		point := PricePoint{Price: product.Price, At: at}
+		if h.append(product.ID, point) && h.file != nil {
+			if err := appendPriceRecord(&records, product.ID, point); err != nil {
+				return fmt.Errorf("encode price history: %w", err)
+			}
+		}
+	}
+	if records.Len() > 0 {
+		if _, err := h.file.Write(records.Bytes()); err != nil {
+			return fmt.Errorf("append price history: %w", err)
+		}
+		if err := h.file.Sync(); err != nil {
+			return fmt.Errorf("sync price history: %w", err)
+		}
+	}
+	if at.Sub(h.compactedAt) >= priceHistoryCompactEvery {
+		return h.compact(at)
+	}
+	return nil
+}
+
+// annotate sets LowestPrice30d: the lowest price in effect during the 30
+// days before the current price took effect, or the current price when the
+// product has no earlier price in that window. It only reads the history:
+// a price that differs from the last recorded one counts as taking effect
+// at at, as observe would record it.
+func (h *PriceHistory) annotate(products []Product, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range products {
+		products[i].LowestPrice30d = products[i].Price
+		earlier, since := h.series[products[i].ID], at
+		if last := len(earlier) - 1; last >= 0 && priceCents(earlier[last].Price) == priceCents(products[i].Price) {
+			earlier, since = earlier[:last], earlier[last].At
+		}
+		// earlier[j] held until earlier[j+1] took effect, the last one
+		// until since.
+		windowStart := since.Add(-priceReferenceWindow)
+		lowest := math.Inf(1)
+		for j, until := len(earlier)-1, since; j >= 0 && until.After(windowStart); j-- {
+			lowest = math.Min(lowest, earlier[j].Price)
+			until = earlier[j].At
+		}
+		if !math.IsInf(lowest, 1) {
+			products[i].LowestPrice30d = lowest
+		}
+	}
+}
+
+// pointsSince returns the product's points in effect at or after since,
+// including the one that was current at since.
+func (h *PriceHistory) pointsSince(id string, since time.Time) []PricePoint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	points := h.series[id]
+	first := 0
+	for first+1 < len(points) && !points[first+1].At.After(since) {
+		first++
+	}
+	return append([]PricePoint{}, points[first:]...)
+}
+
+func (h *PriceHistory) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+func priceCents(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
+
+// ProductPriceHistory returns the product's prices of the last days days.
+// Products missing from the current snapshot are not found, even when the
+// history still remembers them.
+func (s *ProductService) ProductPriceHistory(ctx context.Context, id string, days int) (PriceHistoryResponse, error) {
+	product, _, err := s.GetProduct(ctx, id)
+	if err != nil {
+		return PriceHistoryResponse{}, err
+	}
+	since := s.now().Add(-time.Duration(days) * 24 * time.Hour)
+	return PriceHistoryResponse{
+		ProductID:      product.ID,
+		Price:          product.Price,
+		LowestPrice30d: product.LowestPrice30d,
+		Days:           days,
+		Points:         s.priceHistory.pointsSince(product.ID, since),
+	}, nil
+}
+
+func priceHistoryHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		days, err := ParsePriceHistoryDays(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		history, err := service.ProductPriceHistory(r.Context(), strings.TrimSpace(r.PathValue("id")), days)
+		if errors.Is(err, errProductNotFound) {
+			writeError(w, http.StatusNotFound, "product not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "price history lookup failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to load price history")
+			return
+		}
+
+		setSnapshotHeaders(w, service)
+		writeJSON(w, http.StatusOK, history)
+	})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriceHistory_ObserveAndAnnotate(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return start.Add(time.Duration(n) * 24 * time.Hour) }
+	history := newMemoryPriceHistory()
+
+	for _, step := range []struct {
+		day   int
+		price float64
+	}{{0, 100}, {5, 100.001}, {10, 80}, {20, 120}, {45, 90}} {
+		if err := history.observe([]Product{{ID: "p1", Price: step.price}}, day(step.day)); err != nil {
+			t.Fatalf("unexpected observe error: %v", err)
+		}
+	}
+	if err := history.observe([]Product{{ID: "p1", Price: 120}}, day(30)); err != nil {
+		t.Fatalf("unexpected observe error: %v", err)
+	}
+	if points := history.pointsSince("p1", time.Time{}); len(points) != 4 {
+		t.Fatalf("expected repeated and out-of-order prices to be skipped, got %+v", points)
+	}
+
+	products := []Product{{ID: "p1", Price: 90}, {ID: "p2", Price: 50}}
+	if err := history.observe(products[1:], day(45)); err != nil {
+		t.Fatalf("unexpected observe error: %v", err)
+	}
+	history.annotate(products, day(45))
+	// The window is the 30 days before day 45: 80 was in effect until day
+	// 20, and 100 ended on day 10, before the window.
+	if products[0].LowestPrice30d != 80 {
+		t.Fatalf("expected the lowest earlier price 80, got %v", products[0].LowestPrice30d)
+	}
+	if products[1].LowestPrice30d != 50 {
+		t.Fatalf("expected a product without earlier prices to use its own price, got %v", products[1].LowestPrice30d)
+	}
+
+	// A price not recorded yet takes effect at the annotation time; the
+	// window before day 60 starts on day 30, while 120 was in effect.
+	unrecorded := []Product{{ID: "p1", Price: 70}}
+	history.annotate(unrecorded, day(60))
+	if unrecorded[0].LowestPrice30d != 90 {
+		t.Fatalf("expected the lowest price of the 30 days before the new price, got %v", unrecorded[0].LowestPrice30d)
+	}
+	if points := history.pointsSince("p1", time.Time{}); len(points) != 4 || points[3].Price != 90 {
+		t.Fatalf("expected annotate to leave the history alone, got %+v", points)
+	}
+
+	if got := history.pointsSince("p1", day(25)); len(got) != 2 || got[0].Price != 120 || got[1].Price != 90 {
+		t.Fatalf("expected the price in effect at the start and later changes, got %+v", got)
+	}
+}
+
+func TestOpenPriceHistory_ReplaysPrunesAndPersists(t *testing.T) {
+	captureLogOutput(t)
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "prices.jsonl")
+	lines := []string{
+		`{"id":"p1","price":110,"at":"2026-01-01T00:00:00Z"}`,
+		`{"id":"p1","price":100,"at":"2026-02-01T00:00:00Z"}`,
+		`{"id":"p1","price":90,"at":"2026-05-01T00:00:00Z"}`,
+		`{"id":"p2","price":40,"at":"2026-05-20T00:00:00Z"}`,
+		`{"id":"p2","price":`,
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatalf("write history: %v", err)
+	}
+
+	history, err := OpenPriceHistory(path, now)
+	if err != nil {
+		t.Fatalf("unexpected open error: %v", err)
+	}
+	// 110 ended before the 90-day retention; 100 was still in effect then.
+	if points := history.pointsSince("p1", time.Time{}); len(points) != 2 || points[0].Price != 100 {
+		t.Fatalf("expected the history to be pruned to retention, got %+v", points)
+	}
+	if err := history.observe([]Product{{ID: "p1", Price: 90}, {ID: "p2", Price: 35}}, now); err != nil {
+		t.Fatalf("unexpected observe error: %v", err)
+	}
+	if err := history.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if got := strings.Count(string(content), "\n"); got != 4 || strings.Contains(string(content), "110") {
+		t.Fatalf("expected a compacted file plus one appended change, got %q", content)
+	}
+
+	reopened, err := OpenPriceHistory(path, now)
+	if err != nil {
+		t.Fatalf("unexpected reopen error: %v", err)
+	}
+	defer reopened.Close()
+	products := []Product{{ID: "p1", Price: 90}, {ID: "p2", Price: 35}}
+	reopened.annotate(products, now)
+	if products[0].LowestPrice30d != 100 || products[1].LowestPrice30d != 40 {
+		t.Fatalf("expected reference prices to survive a restart, got %+v", products)
+	}
+
+	// A day after the last compaction, observe drops what fell out of
+	// retention and keeps appending to the rewritten file.
+	later := now.Add(priceHistoryRetention + 48*time.Hour)
+	if err := reopened.observe([]Product{{ID: "p1", Price: 80}, {ID: "p2", Price: 35}}, later); err != nil {
+		t.Fatalf("unexpected observe error: %v", err)
+	}
+	if err := reopened.observe([]Product{{ID: "p2", Price: 30}}, later.Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected observe error: %v", err)
+	}
+	if points := reopened.pointsSince("p1", time.Time{}); len(points) != 2 || points[0].Price != 90 {
+		t.Fatalf("expected observe to prune the history to retention, got %+v", points)
+	}
+	content, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if got := strings.Count(string(content), "\n"); got != 4 || strings.Contains(string(content), `"price":100`) || !strings.Contains(string(content), `"price":30`) {
+		t.Fatalf("expected a compacted file followed by later appends, got %q", content)
+	}
+}
+
+func TestPriceHistory_RecordsOnlyServedPrices(t *testing.T) {
+	captureLogOutput(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 200}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+	service.now = func() time.Time { return now }
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected refresh error: %v", err)
+	}
+	if err := service.PinCatalogVersion(context.Background(), service.CatalogVersion()); err != nil {
+		t.Fatalf("unexpected pin error: %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	source.mu.Lock()
+	source.metadata[0].BasePrice = 20
+	source.mu.Unlock()
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected refresh error: %v", err)
+	}
+	if points := service.priceHistory.pointsSince("p1", time.Time{}); len(points) != 1 || points[0].Price != 200 {
+		t.Fatalf("expected prices held back by the pin to stay out of the history, got %+v", points)
+	}
+
+	if err := service.UnpinCatalogVersion(context.Background()); err != nil {
+		t.Fatalf("unexpected unpin error: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected refresh error: %v", err)
+	}
+	if points := service.priceHistory.pointsSince("p1", time.Time{}); len(points) != 2 || points[1].Price != 20 || !points[1].At.Equal(now) {
+		t.Fatalf("expected the price recorded once served, got %+v", points)
+	}
+}
+
+func TestPriceHistoryHandler(t *testing.T) {
+	captureLogOutput(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 200}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+	service.now = func() time.Time { return now }
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected refresh error: %v", err)
+	}
+	now = now.Add(48 * time.Hour)
+	source.mu.Lock()
+	source.metadata[0].BasePrice = 150
+	source.mu.Unlock()
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected refresh error: %v", err)
+	}
+
+	get := func(method, target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+		return recorder
+	}
+
+	var product Product
+	if recorder := get(http.MethodGet, "/products/p1"); recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &product) != nil || product.LowestPrice30d != 200 {
+		t.Fatalf("expected lowest_price_30d 200 on the product, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder := get(http.MethodGet, "/products/p1/price-history?days=7")
+	var response PriceHistoryResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected price history, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if response.ProductID != "p1" || response.Price != 150 || response.LowestPrice30d != 200 || response.Days != 7 || len(response.Points) != 2 {
+		t.Fatalf("unexpected price history %+v", response)
+	}
+
+	now = now.Add(72 * time.Hour)
+	if recorder := get(http.MethodGet, "/products/p1/price-history?days=1"); !strings.Contains(recorder.Body.String(), `"points":[{"price":150,"at":"2026-03-03T12:00:00Z"}]`) {
+		t.Fatalf("expected only the price in effect during the last day, got %s", recorder.Body.String())
+	}
+	for _, target := range []string{
+		"/products/p1/price-history?days=0",
+		"/products/p1/price-history?days=91",
+		"/products/p1/price-history?days=week",
+		"/products/p1/price-history?days=",
+		"/products/p1/price-history?days=7&days=30",
+		"/products/p1/price-history?day=7",
+	} {
+		if recorder := get(http.MethodGet, target); recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", target, recorder.Code)
+		}
+	}
+	if recorder := get(http.MethodGet, "/products/missing/price-history"); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown product, got %d", recorder.Code)
+	}
+	if recorder := get(http.MethodPost, "/products/p1/price-history"); recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != http.MethodGet {
+		t.Fatalf("expected 405 with Allow: GET, got %d", recorder.Code)
+	}
+}
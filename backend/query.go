@@ -12,6 +12,10 @@ import (
 const (
 	defaultLimit = 6
 	maxLimit     = 100
+
+	defaultSuggestLimit   = 5
+	maxSuggestLimit       = 10
+	maxSuggestQueryLength = 100
 )
 
 var integerPricePattern = regexp.MustCompile(`^\d+$`)
@@ -31,6 +35,21 @@ var allowedQueryParams = map[string]struct{}{
 	"sort":       {},
 	"limit":      {},
 	"offset":     {},
+	"cursor":     {},
+}
+
+var allowedSuggestQueryParams = map[string]struct{}{
+	"q":     {},
+	"limit": {},
+}
+
+var allowedPriceHistoryQueryParams = map[string]struct{}{
+	"days": {},
+}
+
+type SuggestQuery struct {
+	Query string
+	Limit int
 }
 
 type ProductQuery struct {
@@ -48,6 +67,7 @@ type ProductQuery struct {
 	MinStock   *int
 	Limit      int
 	Offset     int
+	Cursor     string
 }
 
 func ParseProductQuery(values url.Values) (ProductQuery, error) {
@@ -180,9 +200,83 @@ func ParseProductQuery(values url.Values) (ProductQuery, error) {
 		query.Offset = parsed
 	}
 
+	cursorRaw, hasCursor, err := singletonQueryValue(values, "cursor")
+	if err != nil {
+		return ProductQuery{}, err
+	}
+	if hasCursor {
+		if hasOffset {
+			return ProductQuery{}, fmt.Errorf("cursor and offset cannot be combined")
+		}
+		query.Cursor = cursorRaw
+	}
+
+	return query, nil
+}
+
+func ParseSuggestQuery(values url.Values) (SuggestQuery, error) {
+	for key := range values {
+		if _, ok := allowedSuggestQueryParams[key]; !ok {
+			return SuggestQuery{}, fmt.Errorf("unsupported query parameter %q", key)
+		}
+	}
+
+	queryRaw, hasQuery, err := singletonQueryValue(values, "q")
+	if err != nil {
+		return SuggestQuery{}, err
+	}
+	if !hasQuery {
+		return SuggestQuery{}, fmt.Errorf("missing q")
+	}
+	if len([]rune(queryRaw)) > maxSuggestQueryLength {
+		return SuggestQuery{}, fmt.Errorf("invalid q: must be at most %d characters", maxSuggestQueryLength)
+	}
+
+	query := SuggestQuery{Query: queryRaw, Limit: defaultSuggestLimit}
+
+	limitRaw, hasLimit, err := singletonQueryValue(values, "limit")
+	if err != nil {
+		return SuggestQuery{}, err
+	}
+	if hasLimit {
+		parsed, err := strconv.Atoi(limitRaw)
+		if err != nil {
+			return SuggestQuery{}, fmt.Errorf("invalid limit: must be an integer")
+		}
+		if parsed <= 0 {
+			return SuggestQuery{}, fmt.Errorf("invalid limit: must be greater than 0")
+		}
+		if parsed > maxSuggestLimit {
+			return SuggestQuery{}, fmt.Errorf("invalid limit: must be <= %d", maxSuggestLimit)
+		}
+		query.Limit = parsed
+	}
+
 	return query, nil
 }
 
+// ParsePriceHistoryDays reads the query of /products/{id}/price-history.
+func ParsePriceHistoryDays(values url.Values) (int, error) {
+	for key := range values {
+		if _, ok := allowedPriceHistoryQueryParams[key]; !ok {
+			return 0, fmt.Errorf("unsupported query parameter %q", key)
+		}
+	}
+
+	daysRaw, hasDays, err := singletonQueryValue(values, "days")
+	if err != nil {
+		return 0, err
+	}
+	if !hasDays {
+		return defaultPriceHistoryDays, nil
+	}
+	days, err := strconv.Atoi(daysRaw)
+	if err != nil || days < 1 || days > maxPriceHistoryDays {
+		return 0, fmt.Errorf("invalid days: must be an integer between 1 and %d", maxPriceHistoryDays)
+	}
+	return days, nil
+}
+
 func parseTokenList(values url.Values, key string) []string {
 	rawValues := values[key]
 	if len(rawValues) == 0 {
@@ -132,6 +132,7 @@ func TestParseProductQuery_SortModes(t *testing.T) {
 		{name: "case insensitive", rawSort: []string{"PRICE_DESC"}, wantSort: "price_desc"},
 		{name: "combined repeated params", rawSort: []string{"popularity", "price_asc"}, wantSort: "popularity,price_asc"},
 		{name: "combined comma list", rawSort: []string{"popularity,price_desc"}, wantSort: "popularity,price_desc"},
+		{name: "relevance", rawSort: []string{"relevance,popularity"}, wantSort: "relevance,popularity"},
 	}
 
 	for _, tc := range tests {
@@ -454,3 +455,54 @@ func TestParseProductQuery_RejectsEmptySingletonParams(t *testing.T) {
 		})
 	}
 }
+
+func TestParseProductQuery_Cursor(t *testing.T) {
+	query, err := ParseProductQuery(url.Values{"cursor": []string{" abc.def "}, "limit": []string{"4"}})
+	if err != nil {
+		t.Fatalf("ParseProductQuery() unexpected error: %v", err)
+	}
+	if query.Cursor != "abc.def" {
+		t.Fatalf("expected trimmed cursor abc.def, got %q", query.Cursor)
+	}
+
+	_, err = ParseProductQuery(url.Values{"cursor": []string{"abc.def"}, "offset": []string{"6"}})
+	if err == nil || !strings.Contains(err.Error(), "cursor and offset cannot be combined") {
+		t.Fatalf("expected cursor/offset conflict error, got %v", err)
+	}
+
+	_, err = ParseProductQuery(url.Values{"cursor": []string{"a.b", "c.d"}})
+	if err == nil || !strings.Contains(err.Error(), "multiple cursor values are not allowed") {
+		t.Fatalf("expected repeated cursor error, got %v", err)
+	}
+}
+
+func TestParseSuggestQuery(t *testing.T) {
+	query, err := ParseSuggestQuery(url.Values{"q": []string{" iph "}})
+	if err != nil {
+		t.Fatalf("ParseSuggestQuery() unexpected error: %v", err)
+	}
+	if query.Query != "iph" || query.Limit != defaultSuggestLimit {
+		t.Fatalf("expected q=iph limit=%d, got %+v", defaultSuggestLimit, query)
+	}
+
+	tests := []struct {
+		name    string
+		values  url.Values
+		wantErr string
+	}{
+		{name: "missing q", values: url.Values{}, wantErr: "missing q"},
+		{name: "empty q", values: url.Values{"q": []string{" "}}, wantErr: "empty q value is not allowed"},
+		{name: "long q", values: url.Values{"q": []string{strings.Repeat("a", maxSuggestQueryLength+1)}}, wantErr: "invalid q"},
+		{name: "limit too high", values: url.Values{"q": []string{"a"}, "limit": []string{"11"}}, wantErr: "invalid limit"},
+		{name: "unsupported param", values: url.Values{"q": []string{"a"}, "search": []string{"a"}}, wantErr: "unsupported query parameter"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseSuggestQuery(tc.values)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
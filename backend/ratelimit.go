@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRateLimitRoute is the rate limit key applied to routes without
+	// their own rule.
+	defaultRateLimitRoute = "*"
+	apiKeyHeader          = "X-API-Key"
+	rateLimitSweepEvery   = time.Minute
+)
+
+// rateLimitRule is a token bucket: Rate tokens per second refill a bucket
+// holding at most Burst, and every request takes one.
+type rateLimitRule struct {
+	Rate  float64
+	Burst int
+}
+
+// window is how long an empty bucket takes to refill.
+func (r rateLimitRule) window() time.Duration {
+	return time.Duration(float64(r.Burst) / r.Rate * float64(time.Second))
+}
+
+// parseRateLimits reads "route=rate/burst" entries separated by commas, where
+// route is a mux pattern such as /products or "*" for every other route.
+func parseRateLimits(raw string) (map[string]rateLimitRule, error) {
+	rules := make(map[string]rateLimitRule)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(entry, "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid rate limit %q: want route=rate/burst", entry)
+		}
+		if route != defaultRateLimitRoute && !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("invalid rate limit route %q: want a path pattern or %q", route, defaultRateLimitRoute)
+		}
+		rawRate, rawBurst, ok := strings.Cut(strings.TrimSpace(limit), "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: want route=rate/burst", entry)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rawRate), 64)
+		if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("invalid rate limit %q: rate must be a positive number of requests per second", entry)
+		}
+		burst, err := strconv.Atoi(strings.TrimSpace(rawBurst))
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", entry)
+		}
+		if _, exists := rules[route]; exists {
+			return nil, fmt.Errorf("duplicate rate limit for route %q", route)
+		}
+		rules[route] = rateLimitRule{Rate: rate, Burst: burst}
+	}
+	return rules, nil
+}
+
+func formatRateLimits(rules map[string]rateLimitRule) string {
+	entries := make([]string, 0, len(rules))
+	for _, route := range sortedKeys(rules) {
+		entries = append(entries, fmt.Sprintf("%s=%s/%d", route, formatFloat(rules[route].Rate), rules[route].Burst))
+	}
+	return strings.Join(entries, ",")
+}
+
+// parseTrustedProxies reads comma-separated IP addresses and CIDR prefixes.
+func parseTrustedProxies(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: want an IP address or CIDR prefix", entry)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func formatTrustedProxies(prefixes []netip.Prefix) string {
+	entries := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		entries[i] = prefix.String()
+	}
+	return strings.Join(entries, ",")
+}
+
+// rateLimiter keeps one token bucket per route and client. Clients are
+// known API keys or, failing that, IP addresses.
+type rateLimiter struct {
+	rules   map[string]rateLimitRule
+	trusted []netip.Prefix
+	apiKeys map[[sha256.Size]byte]struct{}
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	route  string
+	client string
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimitDecision is the outcome of taking a token, with what the
+// RateLimit-* headers report.
+type rateLimitDecision struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// newRateLimiter returns nil when no rule is configured, which disables
+// rate limiting.
+func newRateLimiter(rules map[string]rateLimitRule, trusted []netip.Prefix, apiKeys []string) *rateLimiter {
+	if len(rules) == 0 {
+		return nil
+	}
+	keys := make(map[[sha256.Size]byte]struct{}, len(apiKeys))
+	for _, key := range apiKeys {
+		keys[sha256.Sum256([]byte(key))] = struct{}{}
+	}
+	return &rateLimiter{
+		rules:   rules,
+		trusted: trusted,
+		apiKeys: keys,
+		now:     time.Now,
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+func (l *rateLimiter) rule(route string) (rateLimitRule, bool) {
+	if rule, ok := l.rules[route]; ok {
+		return rule, true
+	}
+	rule, ok := l.rules[defaultRateLimitRoute]
+	return rule, ok
+}
+
+func (l *rateLimiter) take(route, client string, rule rateLimitRule) rateLimitDecision {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepLocked(now)
+
+	key := bucketKey{route: route, client: client}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(rule.Burst), updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.refill(rule, now)
+
+	decision := rateLimitDecision{allowed: bucket.tokens >= 1}
+	if decision.allowed {
+		bucket.tokens--
+	} else {
+		decision.retryAfter = secondsToDuration((1 - bucket.tokens) / rule.Rate)
+	}
+	decision.remaining = int(bucket.tokens)
+	decision.reset = secondsToDuration((float64(rule.Burst) - bucket.tokens) / rule.Rate)
+	return decision
+}
+
+func (b *tokenBucket) refill(rule rateLimitRule, now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(rule.Burst), b.tokens+elapsed*rule.Rate)
+	}
+	b.updated = now
+}
+
+// sweepLocked drops buckets that have refilled completely, since a new
+// bucket starts full anyway.
+func (l *rateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepEvery {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		rule, ok := l.rule(key.route)
+		if !ok || now.Sub(bucket.updated) >= rule.window() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey identifies the client by a configured API key when the request
+// presents one, and by IP address otherwise. Unknown keys are ignored so
+// they cannot be rotated to get fresh buckets.
+func (l *rateLimiter) clientKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		if _, ok := l.apiKeys[sum]; ok {
+			return "key:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + l.clientIP(r)
+}
+
+// clientIP is the peer address unless the peer is a trusted proxy. Then
+// X-Forwarded-For is walked from the right, skipping trusted proxies, and
+// the first other address is the client. Entries left of it were supplied
+// by the client and cannot be trusted.
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	client, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	client = client.Unmap()
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && l.isTrusted(client); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+	}
+	return client.String()
+}
+
+func (l *rateLimiter) isTrusted(addr netip.Addr) bool {
+	return slices.ContainsFunc(l.trusted, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// withRateLimit applies the rule of the matched route. Every limited
+// response carries RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset
+// and RateLimit-Policy; rejected ones get 429 with Retry-After.
+func withRateLimit(next http.Handler, routes *http.ServeMux, limiter *rateLimiter) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routePattern(routes, r)
+		rule, ok := limiter.rule(route)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := limiter.clientKey(r)
+		decision := limiter.take(route, client, rule)
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(rule.Burst))
+		header.Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		header.Set("RateLimit-Reset", ceilSeconds(decision.reset))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", rule.Burst, ceilSeconds(rule.window())))
+		if !decision.allowed {
+			slog.DebugContext(r.Context(), "request rate limited", "route", route, "client", client)
+			header.Set("Retry-After", ceilSeconds(decision.retryAfter))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
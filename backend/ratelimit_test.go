@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	rules, err := parseRateLimits(" /products=5/10, /products/{id}=0.5/1,*=20/40 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rules["/products"] != (rateLimitRule{Rate: 5, Burst: 10}) || rules["/products/{id}"] != (rateLimitRule{Rate: 0.5, Burst: 1}) || len(rules) != 3 {
+		t.Fatalf("unexpected rules: %+v", rules)
+	}
+	if got := formatRateLimits(rules); got != "*=20/40,/products=5/10,/products/{id}=0.5/1" {
+		t.Fatalf("unexpected formatted rules %q", got)
+	}
+
+	for raw, want := range map[string]string{
+		"/products":                       "want route=rate/burst",
+		"/products=5":                     "want route=rate/burst",
+		"products=5/10":                   "want a path pattern",
+		"/products=0/10":                  "rate must be a positive number",
+		"/products=5/0":                   "burst must be a positive integer",
+		"/products=5/10,/products=1/1":    "duplicate rate limit",
+		"/products=fast/10":               "rate must be a positive number",
+		"/products=5/10,/health=5/ten":    "burst must be a positive integer",
+		"/products=5/10,=5/10":            "want route=rate/burst",
+		"/products=5/10, /metrics=+Inf/1": "rate must be a positive number",
+	} {
+		if _, err := parseRateLimits(raw); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q error for %q, got %v", want, raw, err)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.7, ::1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := formatTrustedProxies(prefixes); got != "10.0.0.0/8,192.168.1.7/32,::1/128" {
+		t.Fatalf("unexpected prefixes %q", got)
+	}
+	if _, err := parseTrustedProxies("10.0.0.0/8,proxy.internal"); err == nil || !strings.Contains(err.Error(), `invalid trusted proxy "proxy.internal"`) {
+		t.Fatalf("expected invalid proxy error, got %v", err)
+	}
+}
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rule := rateLimitRule{Rate: 2, Burst: 2}
+	limiter := newRateLimiter(map[string]rateLimitRule{"/products": rule}, nil, nil)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if decision := limiter.take("/products", "ip:a", rule); !decision.allowed || decision.remaining != 1-i {
+			t.Fatalf("expected request %d within the burst, got %+v", i, decision)
+		}
+	}
+	denied := limiter.take("/products", "ip:a", rule)
+	if denied.allowed || denied.retryAfter != 500*time.Millisecond || denied.reset != time.Second {
+		t.Fatalf("expected a denial with a 500ms retry, got %+v", denied)
+	}
+	if other := limiter.take("/products", "ip:b", rule); !other.allowed {
+		t.Fatal("expected other clients to have their own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if decision := limiter.take("/products", "ip:a", rule); !decision.allowed || decision.remaining != 0 {
+		t.Fatalf("expected one refilled token, got %+v", decision)
+	}
+
+	now = now.Add(time.Hour)
+	limiter.take("/products", "ip:c", rule)
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("expected refilled buckets to be swept, got %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestRateLimiter_ClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	limiter := newRateLimiter(map[string]rateLimitRule{"*": {Rate: 1, Burst: 1}}, trusted, nil)
+
+	for _, tc := range []struct {
+		remote string
+		xff    []string
+		want   string
+	}{
+		{remote: "203.0.113.9:4000", want: "203.0.113.9"},
+		{remote: "203.0.113.9:4000", xff: []string{"198.51.100.1"}, want: "203.0.113.9"},
+		{remote: "10.0.0.2:4000", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{remote: "10.0.0.2:4000", xff: []string{"1.2.3.4, 198.51.100.1, 10.0.0.3"}, want: "198.51.100.1"},
+		{remote: "10.0.0.2:4000", xff: []string{"1.2.3.4", "198.51.100.1"}, want: "198.51.100.1"},
+		{remote: "10.0.0.2:4000", xff: []string{"10.0.0.4, 10.0.0.3"}, want: "10.0.0.4"},
+		{remote: "10.0.0.2:4000", xff: []string{"1.2.3.4, garbage"}, want: "10.0.0.2"},
+		{remote: "[::ffff:10.0.0.2]:4000", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{remote: "10.0.0.2:4000", want: "10.0.0.2"},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/products", nil)
+		request.RemoteAddr = tc.remote
+		for _, value := range tc.xff {
+			request.Header.Add("X-Forwarded-For", value)
+		}
+		if got := limiter.clientIP(request); got != tc.want {
+			t.Fatalf("clientIP(%s, %v) = %q, want %q", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	captureLogOutput(t)
+	service := NewProductService(&fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}, 30*time.Second)
+	metrics := NewMetrics()
+	handler := buildServerHandler(service, metrics, serverConfig{
+		CORSAllowOrigin:  "*",
+		RateLimits:       map[string]rateLimitRule{"/products": {Rate: 0.1, Burst: 2}},
+		TrustedProxies:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		RateLimitAPIKeys: []string{"partner-key"},
+	})
+	get := func(path, remote, apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.RemoteAddr = remote
+		if apiKey != "" {
+			request.Header.Set(apiKeyHeader, apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := get("/products", "203.0.113.9:4000", "")
+	if first.Code != http.StatusOK || first.Header().Get("RateLimit-Limit") != "2" || first.Header().Get("RateLimit-Remaining") != "1" || first.Header().Get("RateLimit-Policy") != "2;w=20" {
+		t.Fatalf("expected rate limit headers on an allowed request, got %d %v", first.Code, first.Header())
+	}
+	get("/products", "203.0.113.9:4000", "unknown-key")
+
+	limited := get("/products", "203.0.113.9:4000", "")
+	if limited.Code != http.StatusTooManyRequests || limited.Header().Get("Retry-After") != "10" || limited.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", limited.Code, limited.Header())
+	}
+	var payload errorResponse
+	if err := json.Unmarshal(limited.Body.Bytes(), &payload); err != nil || payload.Error != "rate limit exceeded" {
+		t.Fatalf("expected errorResponse body, got %q (%v)", limited.Body.String(), err)
+	}
+
+	if recorder := get("/products", "203.0.113.9:4000", "partner-key"); recorder.Code != http.StatusOK {
+		t.Fatalf("expected a known API key to get its own bucket, got %d", recorder.Code)
+	}
+	if recorder := get("/products", "203.0.113.10:4000", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("expected another IP to get its own bucket, got %d", recorder.Code)
+	}
+	if recorder := get("/products/p1", "203.0.113.9:4000", ""); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "" {
+		t.Fatalf("expected routes without a rule to be unlimited, got %d %v", recorder.Code, recorder.Header())
+	}
+
+	assertMetricLine(t, scrapeMetrics(t, handler), `http_requests_total{route="/products",status="429"} 1`)
+}
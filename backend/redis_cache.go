@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisKeyPrefix      = "assignment-backend:products"
+	redisCommandTimeout = 2 * time.Second
+	// redisUnlockScript deletes the lock only while it still holds our token,
+	// so a replica whose lock expired cannot release a successor's lock.
+	redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// RedisSnapshotCache shares snapshots between replicas through any server
+// speaking the Redis protocol. Commands only run around rebuilds, so each
+// call opens a short-lived connection instead of keeping a pool.
+type RedisSnapshotCache struct {
+	addr     string
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+	key      string
+	lockKey  string
+	pinKey   string
+}
+
+func NewRedisSnapshotCache(rawURL string) (*RedisSnapshotCache, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	if parsed.Scheme != "redis" {
+		return nil, fmt.Errorf("parse redis url: unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("parse redis url: missing host")
+	}
+
+	addr := parsed.Host
+	if parsed.Port() == "" {
+		addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+
+	db := 0
+	if path := strings.Trim(parsed.Path, "/"); path != "" {
+		db, err = strconv.Atoi(path)
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("parse redis url: invalid database %q", path)
+		}
+	}
+
+	cache := &RedisSnapshotCache{
+		addr:    addr,
+		db:      db,
+		timeout: redisCommandTimeout,
+		key:     fmt.Sprintf("%s:snapshot:v%d", redisKeyPrefix, snapshotFormatVersion),
+		lockKey: redisKeyPrefix + ":rebuild-lock",
+		pinKey:  fmt.Sprintf("%s:pin:v%d", redisKeyPrefix, snapshotFormatVersion),
+	}
+	if parsed.User != nil {
+		cache.username = parsed.User.Username()
+		cache.password, _ = parsed.User.Password()
+	}
+	return cache, nil
+}
+
+func (c *RedisSnapshotCache) Load(ctx context.Context) (*cachedSnapshot, error) {
+	reply, err := c.do(ctx, "GET", c.key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, nil
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return decodeCachedSnapshot(data)
+}
+
+func (c *RedisSnapshotCache) Store(ctx context.Context, snapshot *cachedSnapshot, ttl time.Duration) error {
+	data, err := encodeCachedSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, "SET", c.key, string(data), "PX", redisMilliseconds(ttl))
+	return err
+}
+
+func (c *RedisSnapshotCache) Delete(ctx context.Context) error {
+	_, err := c.do(ctx, "DEL", c.key)
+	return err
+}
+
+func (c *RedisSnapshotCache) LoadPin(ctx context.Context) (*cachedSnapshot, error) {
+	reply, err := c.do(ctx, "GET", c.pinKey)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, nil
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return decodeCachedSnapshot(data)
+}
+
+// StorePin keeps the pin without an expiry, so it outlives restarts of
+// every replica until it is removed.
+func (c *RedisSnapshotCache) StorePin(ctx context.Context, snapshot *cachedSnapshot) error {
+	if snapshot == nil {
+		_, err := c.do(ctx, "DEL", c.pinKey)
+		return err
+	}
+	data, err := encodeCachedSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, "SET", c.pinKey, string(data))
+	return err
+}
+
+func (c *RedisSnapshotCache) Lock(ctx context.Context, ttl time.Duration) (func(), bool, error) {
+	token, err := randomLockToken()
+	if err != nil {
+		return nil, false, err
+	}
+
+	reply, err := c.do(ctx, "SET", c.lockKey, token, "NX", "PX", redisMilliseconds(ttl))
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+		if _, err := c.do(unlockCtx, "EVAL", redisUnlockScript, "1", c.lockKey, token); err != nil {
+			slog.Warn("snapshot rebuild lock release failed", "expires_in", ttl.String(), "error", err)
+		}
+	}
+	return unlock, true, nil
+}
+
+func (c *RedisSnapshotCache) do(ctx context.Context, args ...string) (any, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: dial %s: %w", c.addr, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	commands := make([][]string, 0, 3)
+	if c.password != "" {
+		if c.username != "" {
+			commands = append(commands, []string{"AUTH", c.username, c.password})
+		} else {
+			commands = append(commands, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	commands = append(commands, args)
+
+	writer := bufio.NewWriter(conn)
+	for _, command := range commands {
+		writeRESPCommand(writer, command)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("redis: write: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	var reply any
+	for range commands {
+		reply, err = readRESPReply(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+func writeRESPCommand(w *bufio.Writer, args []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readRESPReply decodes one reply: simple strings as string, integers as
+// int64, bulk strings as []byte, arrays as []any and null replies as nil.
+// Error replies are returned as redisError.
+func readRESPReply(r *bufio.Reader) (any, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		value, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed integer reply %q", line)
+		}
+		return value, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk reply %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("redis: read: %w", err)
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array reply %q", line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = readRESPReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("redis: connection closed")
+		}
+		return "", fmt.Errorf("redis: read: %w", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+func redisMilliseconds(d time.Duration) string {
+	ms := d.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+func randomLockToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("generate lock token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 )
 
@@ -16,6 +17,10 @@ type PopularitySource interface {
 	LoadPopularity(context.Context) ([]PopularityRecord, error)
 }
 
+type OfferSource interface {
+	LoadOffers(context.Context) ([]OfferRecord, error)
+}
+
 type FileProductSource struct {
 	MetadataPath string
 	DetailsPath  string
@@ -25,6 +30,10 @@ type FilePopularitySource struct {
 	Path string
 }
 
+type FileOfferSource struct {
+	Path string
+}
+
 func (s FileProductSource) LoadMetadata(ctx context.Context) ([]MetadataRecord, error) {
 	return readJSONFile[MetadataRecord](ctx, s.MetadataPath)
 }
@@ -37,6 +46,10 @@ func (s FilePopularitySource) LoadPopularity(ctx context.Context) ([]PopularityR
 	return readJSONFile[PopularityRecord](ctx, s.Path)
 }
 
+func (s FileOfferSource) LoadOffers(ctx context.Context) ([]OfferRecord, error) {
+	return readJSONFile[OfferRecord](ctx, s.Path)
+}
+
 func readJSONFile[T any](ctx context.Context, path string) ([]T, error) {
 	select {
 	case <-ctx.Done():
@@ -54,5 +67,6 @@ func readJSONFile[T any](ctx context.Context, path string) ([]T, error) {
 		return nil, fmt.Errorf("decode %s: %w", path, err)
 	}
 
+	slog.DebugContext(ctx, "source file loaded", "path", path, "records", len(records))
 	return records, nil
 }
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	searchWeightName      = 3.0
+	searchWeightBrand     = 2.0
+	searchWeightCategory  = 1.5
+	searchWeightCondition = 1.0
+
+	searchQualityExact  = 1.0
+	searchQualityPrefix = 0.75
+	searchQualityTypo   = 0.5
+)
+
+type searchIndex struct {
+	ids      []string
+	terms    []string
+	postings map[string][]searchPosting
+}
+
+type searchPosting struct {
+	product int
+	weight  float64
+}
+
+func buildSearchIndex(products []Product) *searchIndex {
+	index := &searchIndex{
+		ids:      make([]string, len(products)),
+		postings: make(map[string][]searchPosting),
+	}
+
+	for i, product := range products {
+		index.ids[i] = product.ID
+
+		weights := make(map[string]float64)
+		addSearchTerms(weights, product.Name, searchWeightName)
+		addSearchTerms(weights, product.Brand, searchWeightBrand)
+		addSearchTerms(weights, product.Category, searchWeightCategory)
+		addSearchTerms(weights, product.Condition, searchWeightCondition)
+
+		for term, weight := range weights {
+			index.postings[term] = append(index.postings[term], searchPosting{product: i, weight: weight})
+		}
+	}
+
+	index.terms = make([]string, 0, len(index.postings))
+	for term := range index.postings {
+		index.terms = append(index.terms, term)
+	}
+	slices.Sort(index.terms)
+
+	return index
+}
+
+func addSearchTerms(weights map[string]float64, text string, weight float64) {
+	for _, term := range tokenizeSearchText(text) {
+		if weight > weights[term] {
+			weights[term] = weight
+		}
+	}
+}
+
+// search returns a relevance score per matching product ID. Every query
+// token must match a term of the product (exactly, as a prefix, or within
+// the typo budget); a nil result means no search is active.
+func (idx *searchIndex) search(rawQuery string) map[string]float64 {
+	if strings.TrimSpace(rawQuery) == "" {
+		return nil
+	}
+
+	scores := make(map[string]float64)
+	tokens := tokenizeSearchText(rawQuery)
+	if idx == nil || len(tokens) == 0 {
+		return scores
+	}
+
+	var total map[int]float64
+	for _, token := range tokens {
+		tokenScores := idx.scoreToken(token)
+		if total == nil {
+			total = tokenScores
+			continue
+		}
+		for product := range total {
+			score, ok := tokenScores[product]
+			if !ok {
+				delete(total, product)
+				continue
+			}
+			total[product] += score
+		}
+	}
+
+	for product, score := range total {
+		scores[idx.ids[product]] = score
+	}
+	return scores
+}
+
+func (idx *searchIndex) scoreToken(token string) map[int]float64 {
+	scores := make(map[int]float64)
+	apply := func(term string, quality float64) {
+		for _, posting := range idx.postings[term] {
+			score := quality * posting.weight
+			if score > scores[posting.product] {
+				scores[posting.product] = score
+			}
+		}
+	}
+
+	start, _ := slices.BinarySearch(idx.terms, token)
+	for i := start; i < len(idx.terms) && strings.HasPrefix(idx.terms[i], token); i++ {
+		if idx.terms[i] == token {
+			apply(idx.terms[i], searchQualityExact)
+		} else {
+			apply(idx.terms[i], searchQualityPrefix)
+		}
+	}
+
+	budget := typoBudget(token)
+	if budget == 0 {
+		return scores
+	}
+	tokenRunes := []rune(token)
+	for _, term := range idx.terms {
+		if strings.HasPrefix(term, token) {
+			continue
+		}
+		distance, ok := typoDistance(tokenRunes, []rune(term), budget)
+		if !ok {
+			continue
+		}
+		apply(term, searchQualityTypo/float64(distance))
+	}
+
+	return scores
+}
+
+func typoBudget(token string) int {
+	length := len([]rune(token))
+	switch {
+	case length >= 8:
+		return 2
+	case length >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// typoDistance compares the token with the whole term and with term
+// prefixes of similar length, so "airpdo" still reaches "airpods".
+func typoDistance(token []rune, term []rune, budget int) (int, bool) {
+	best := budget + 1
+	candidates := []int{len(term), len(token) - 1, len(token), len(token) + 1}
+	for _, length := range candidates {
+		if length <= 0 || length > len(term) {
+			continue
+		}
+		if d := boundedEditDistance(token, term[:length], budget); d < best {
+			best = d
+		}
+	}
+	return best, best <= budget
+}
+
+func boundedEditDistance(a []rune, b []rune, budget int) int {
+	if diff := len(a) - len(b); diff > budget || -diff > budget {
+		return budget + 1
+	}
+
+	previousRow := make([]int, len(b)+1)
+	currentRow := make([]int, len(b)+1)
+	beforePreviousRow := make([]int, len(b)+1)
+	for j := range previousRow {
+		previousRow[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		currentRow[0] = i
+		rowMin := currentRow[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			value := min(previousRow[j]+1, currentRow[j-1]+1, previousRow[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				value = min(value, beforePreviousRow[j-2]+1)
+			}
+			currentRow[j] = value
+			rowMin = min(rowMin, value)
+		}
+		if rowMin > budget {
+			return budget + 1
+		}
+		beforePreviousRow, previousRow, currentRow = previousRow, currentRow, beforePreviousRow
+	}
+
+	return previousRow[len(b)]
+}
+
+func tokenizeSearchText(text string) []string {
+	folded := foldSearchText(text)
+	fields := strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]struct{}, len(fields))
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if _, ok := seen[field]; ok {
+			continue
+		}
+		seen[field] = struct{}{}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
+
+func foldSearchText(text string) string {
+	var builder strings.Builder
+	builder.Grow(len(text))
+	for _, r := range strings.ToLower(text) {
+		if folded, ok := accentFolds[r]; ok {
+			builder.WriteString(folded)
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+var accentFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func searchFixtureProducts() []Product {
+	return []Product{
+		{ID: "p1", Name: "MacBook Air 13", Brand: "apple", Category: "laptops", Condition: "refurbished"},
+		{ID: "p2", Name: "MacBook Pro 16", Brand: "apple", Category: "laptops", Condition: "used"},
+		{ID: "p3", Name: "AirPods Pro", Brand: "apple", Category: "audio", Condition: "refurbished"},
+		{ID: "p4", Name: "Galaxy Buds", Brand: "samsung", Category: "audio", Condition: "refurbished"},
+		{ID: "p5", Name: "Café Crème Speaker", Brand: "Sonos", Category: "audio", Condition: "used"},
+	}
+}
+
+func searchIDs(scores map[string]float64) string {
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	return strings.Join(sortedFacetValues(normalizedTokenSet(ids)), ",")
+}
+
+func TestSearchIndex_MatchesTokensAcrossFields(t *testing.T) {
+	index := buildSearchIndex(searchFixtureProducts())
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "all tokens required", query: "macbook 13", want: "p1"},
+		{name: "prefix", query: "airpod", want: "p3"},
+		{name: "typo", query: "galxy", want: "p4"},
+		{name: "transposed typo in prefix", query: "airpdo", want: "p3"},
+		{name: "brand text", query: "samsung", want: "p4"},
+		{name: "category text", query: "laptops", want: "p1,p2"},
+		{name: "condition text", query: "used audio", want: "p5"},
+		{name: "accent folding", query: "cafe creme", want: "p5"},
+		{name: "accented query", query: "Mäcbook pro", want: "p2"},
+		{name: "no match", query: "tablet", want: ""},
+		{name: "short tokens are not typo tolerant", query: "pto", want: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := index.search(tc.query)
+			if got == nil {
+				t.Fatalf("expected non-nil scores for active search")
+			}
+			if ids := searchIDs(got); ids != tc.want {
+				t.Fatalf("expected matches [%s] for %q, got [%s]", tc.want, tc.query, ids)
+			}
+		})
+	}
+
+	if scores := index.search("   "); scores != nil {
+		t.Fatalf("expected nil scores for blank search, got %v", scores)
+	}
+}
+
+func TestSearchIndex_ScoresExactNameAboveWeakerMatches(t *testing.T) {
+	index := buildSearchIndex(searchFixtureProducts())
+
+	scores := index.search("pro")
+	if scores["p2"] <= 0 || scores["p3"] <= 0 {
+		t.Fatalf("expected both pro products to match, got %v", scores)
+	}
+
+	scores = index.search("apple air")
+	if scores["p1"] <= scores["p3"] {
+		t.Fatalf("expected exact name token to outrank prefix match, got p1=%v p3=%v", scores["p1"], scores["p3"])
+	}
+}
+
+func TestProductService_SortByRelevance(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Phone Case", BasePrice: 20, Brand: "generic", Category: "accessories"},
+			{ID: "p2", Name: "iPhone 13", BasePrice: 600, Brand: "apple", Category: "smartphones"},
+			{ID: "p3", Name: "Galaxy", BasePrice: 500, Brand: "samsung", Category: "phones"},
+		},
+		details: []DetailsRecord{{ID: "p1"}, {ID: "p2"}, {ID: "p3"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{Search: "phone", Sort: SortRelevance})
+	if err != nil {
+		t.Fatalf("QueryProducts() unexpected error: %v", err)
+	}
+
+	ids := make([]string, 0, len(response.Items))
+	for _, item := range response.Items {
+		ids = append(ids, item.ID)
+	}
+	if strings.Join(ids, ",") != "p1,p2,p3" {
+		t.Fatalf("expected exact name, then near-miss name, then category prefix [p1 p2 p3], got %v", ids)
+	}
+}
@@ -2,46 +2,123 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"slices"
 	"strings"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ProductService struct {
 	source           ProductSource
 	popularitySource PopularitySource
+	offerSource      OfferSource
+	bestOfferPolicy  BestOfferPolicy
 	ttl              time.Duration
+	maxStale         time.Duration
 	now              func() time.Time
+	cursors          cursorCodec
+	snapshotCache    SnapshotCache
+	lockWait         time.Duration
+	sources          sourceStates
+	versions         catalogVersions
+	metrics          *Metrics
+	// validationPolicies overrides the default policy of validation rules
+	// by rule name.
+	validationPolicies map[string]ValidationPolicy
+	priceHistory       *PriceHistory
+	snapshotFile       *SnapshotFile
+
+	// diagnosticsMu guards the reports of the last local snapshot build and
+	// the load outcomes behind readiness.
+	diagnosticsMu sync.Mutex
+	qualityReport *DataQualityReport
+	orphanReport  *OrphanReport
+	sourceHealth  map[string]*sourceHealth
+	lastLoadErr   string
 
 	mu        sync.Mutex
 	cached    *productSnapshot
+	loadedAt  time.Time
 	expiresAt time.Time
-	loading   bool
-	loadDone  chan struct{}
+	// freshFor is how long the cached snapshot was fresh when it was loaded.
+	freshFor time.Duration
+	loading  bool
+	loadDone chan struct{}
 }
 
-const staleRetryWindow = 2 * time.Second
+const (
+	staleRetryWindow = 2 * time.Second
+	snapshotLockTTL  = 30 * time.Second
+	snapshotLockWait = 5 * time.Second
+	snapshotLockPoll = 100 * time.Millisecond
+)
+
+var errProductNotFound = errors.New("product not found")
 
 type productSnapshot struct {
 	products        []Product
+	productIndex    map[string]int
+	productETags    []string
 	availableColors []string
 	availableBrands []string
 	priceMin        float64
 	priceMax        float64
+	facetUniverse   facetUniverse
+	searchIndex     *searchIndex
+	suggestIndex    *suggestIndex
+	dataVersion     string
+	// version hashes the product content; builtAt is when the sources were
+	// read, which may be on another replica when shared through the cache.
+	version string
+	builtAt time.Time
+	// warnings lists non-fatal problems of the local build. Snapshots
+	// adopted from the shared cache have none.
+	warnings []string
+	// nextRefresh is when the first source of a local build is due again.
+	// Adopted snapshots leave it zero and stay fresh for refreshEvery.
+	nextRefresh time.Time
+	// restored snapshots come from the snapshot file of an earlier run and
+	// are served as stale until a load succeeds.
+	restored bool
+	// catalogVersion is the ID of the catalog version the snapshot belongs
+	// to, assigned when it is published.
+	catalogVersion string
+}
+
+type dataVersioner interface {
+	DataVersion() string
 }
 
 func NewProductService(source ProductSource, ttl time.Duration) *ProductService {
 	if ttl <= 0 {
 		ttl = DefaultCacheTTLDuration
 	}
+	maxStale := DefaultCacheMaxStaleDuration
+	if maxStale < ttl {
+		maxStale = ttl
+	}
 	return &ProductService{
-		source: source,
-		ttl:    ttl,
-		now:    time.Now,
+		source:          source,
+		ttl:             ttl,
+		maxStale:        maxStale,
+		now:             time.Now,
+		cursors:         newCursorCodec(nil),
+		snapshotCache:   NewMemorySnapshotCache(),
+		lockWait:        snapshotLockWait,
+		sources:         newSourceStates(ttl),
+		priceHistory:    newMemoryPriceHistory(),
+		bestOfferPolicy: DefaultBestOfferPolicy,
+		versions:        catalogVersions{limit: DefaultCatalogVersions},
 	}
 }
 
@@ -50,19 +127,96 @@ func (s *ProductService) WithPopularitySource(source PopularitySource) *ProductS
 	return s
 }
 
-func (s *ProductService) QueryProducts(ctx context.Context, query ProductQuery) (ProductListResponse, error) {
+// WithOfferSource adds merchant offers. Like popularity they are optional:
+// when they fail to load, products keep the price, stock and condition of
+// their details record.
+func (s *ProductService) WithOfferSource(source OfferSource, policy BestOfferPolicy) *ProductService {
+	s.offerSource = source
+	if policy != "" {
+		s.bestOfferPolicy = policy
+	}
+	return s
+}
+
+func (s *ProductService) WithMaxStaleness(maxStale time.Duration) *ProductService {
+	if maxStale < s.ttl {
+		maxStale = s.ttl
+	}
+	s.maxStale = maxStale
+	return s
+}
+
+func (s *ProductService) WithCursorSecret(secret string) *ProductService {
+	s.cursors = newCursorCodec([]byte(secret))
+	return s
+}
+
+func (s *ProductService) WithMetrics(metrics *Metrics) *ProductService {
+	s.metrics = metrics
+	return s
+}
+
+func (s *ProductService) WithValidationPolicies(overrides map[string]ValidationPolicy) *ProductService {
+	s.validationPolicies = overrides
+	return s
+}
+
+func (s *ProductService) WithSnapshotCache(cache SnapshotCache) *ProductService {
+	if cache != nil {
+		s.snapshotCache = cache
+	}
+	return s
+}
+
+// WithPriceHistory replaces the in-memory price history, typically with one
+// opened from a file so that it survives restarts.
+func (s *ProductService) WithPriceHistory(history *PriceHistory) *ProductService {
+	if history != nil {
+		s.priceHistory = history
+	}
+	return s
+}
+
+// WithSnapshotFile saves every loaded snapshot to file; RestoreSnapshot
+// serves it after a restart.
+func (s *ProductService) WithSnapshotFile(file *SnapshotFile) *ProductService {
+	s.snapshotFile = file
+	return s
+}
+
+func (s *ProductService) QueryProducts(ctx context.Context, query ProductQuery) (response ProductListResponse, err error) {
 	query = sanitizeQuery(query)
 
+	ctx, span := startSpan(ctx, "QueryProducts", productQueryAttributes(query)...)
+	defer func() {
+		span.SetAttributes(attribute.Int("products.total", response.Total), attribute.Int("products.returned", len(response.Items)))
+		endSpan(span, err)
+	}()
+
 	snapshot, err := s.getSnapshot(ctx)
 	if err != nil {
 		return ProductListResponse{}, err
 	}
 
-	filtered := filterProducts(snapshot.products, query)
+	filter := newProductFilter(query, snapshot.searchIndex.search(query.Search))
+	_, filterSpan := startSpan(ctx, "filterProducts", attribute.Int("products.candidates", len(snapshot.products)))
+	filtered := filterProducts(snapshot.products, filter)
+	filterSpan.SetAttributes(attribute.Int("products.matched", len(filtered)))
+	filterSpan.End()
 	sortProducts(filtered, query.Sort)
 	total := len(filtered)
 
 	start := query.Offset
+	if query.Cursor != "" {
+		cursor, err := s.cursors.decode(query.Cursor)
+		if err != nil {
+			return ProductListResponse{}, err
+		}
+		if cursor.Query != queryFingerprint(query) {
+			return ProductListResponse{}, fmt.Errorf("%w: does not match the current filters and sort", errInvalidCursor)
+		}
+		start = resumeIndex(filtered, cursor, parseSortModes(query.Sort))
+	}
 	if start > total {
 		start = total
 	}
@@ -76,6 +230,15 @@ func (s *ProductService) QueryProducts(ctx context.Context, query ProductQuery)
 	if len(page) == 0 {
 		page = []Product{}
 	}
+	nextCursor := ""
+	if end < total && end > start {
+		nextCursor = s.cursors.encode(cursorForProduct(filtered[end-1], end-1, query))
+	}
+	offset := query.Offset
+	if query.Cursor != "" {
+		offset = start
+	}
+	slog.DebugContext(ctx, "products queried", "total", total, "returned", len(page), "offset", offset)
 	availableColors := cloneStringSlice(snapshot.availableColors)
 	availableBrands := cloneStringSlice(snapshot.availableBrands)
 
@@ -83,16 +246,158 @@ func (s *ProductService) QueryProducts(ctx context.Context, query ProductQuery)
 		Items:           page,
 		Total:           total,
 		Limit:           query.Limit,
-		Offset:          query.Offset,
+		Offset:          offset,
 		HasMore:         end < total,
+		NextCursor:      nextCursor,
 		AvailableColors: availableColors,
 		AvailableBrands: availableBrands,
 		PriceMin:        snapshot.priceMin,
 		PriceMax:        snapshot.priceMax,
+		Facets:          computeFacets(snapshot.products, snapshot.facetUniverse, filter),
 	}, nil
 }
 
+func (s *ProductService) GetProduct(ctx context.Context, id string) (Product, string, error) {
+	snapshot, err := s.getSnapshot(ctx)
+	if err != nil {
+		return Product{}, "", err
+	}
+
+	index, ok := snapshot.productIndex[strings.TrimSpace(id)]
+	if !ok {
+		return Product{}, "", errProductNotFound
+	}
+
+	product := cloneProducts(snapshot.products[index : index+1])[0]
+	return product, snapshot.productETags[index], nil
+}
+
+func (s *ProductService) SuggestProducts(ctx context.Context, query SuggestQuery) (SuggestionResponse, error) {
+	snapshot, err := s.getSnapshot(ctx)
+	if err != nil {
+		return SuggestionResponse{}, err
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	if limit > maxSuggestLimit {
+		limit = maxSuggestLimit
+	}
+
+	return snapshot.suggestIndex.suggest(strings.TrimSpace(query.Query), limit), nil
+}
+
+// Refresh rebuilds the snapshot now, after any load already in flight.
+func (s *ProductService) Refresh(ctx context.Context) error {
+	_, err := s.refreshSnapshot(ctx)
+	return err
+}
+
+// refreshSnapshot returns the rebuilt snapshot, or on failure the snapshot
+// that keeps serving (nil when there is none) with the error.
+func (s *ProductService) refreshSnapshot(ctx context.Context) (*productSnapshot, error) {
+	for {
+		s.mu.Lock()
+		if s.loading {
+			loadDone := s.loadDone
+			s.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-loadDone:
+				continue
+			}
+		}
+
+		loadDone := s.beginLoadLocked()
+		s.mu.Unlock()
+
+		return s.runLoad(context.WithoutCancel(ctx), loadDone, true)
+	}
+}
+
+// Invalidate drops the local snapshot and the shared cache entry, so the
+// next request rebuilds from the sources. Until that load succeeds there is
+// no stale snapshot to fall back on. A pinned catalog version stays pinned
+// and keeps serving.
+func (s *ProductService) Invalidate(ctx context.Context) error {
+	s.mu.Lock()
+	s.cached = nil
+	s.loadedAt = time.Time{}
+	s.expiresAt = time.Time{}
+	pinned := s.versions.pinned
+	s.mu.Unlock()
+	s.resetSources()
+
+	if err := s.snapshotCache.Delete(ctx); err != nil {
+		return fmt.Errorf("delete shared snapshot: %w", err)
+	}
+	slog.InfoContext(ctx, "snapshot cache invalidated", "pinned_catalog_version", pinned)
+	return nil
+}
+
+func (s *ProductService) DataVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if served := s.servedLocked(); served != nil {
+		return served.dataVersion
+	}
+	return ""
+}
+
+type cacheState struct {
+	age          time.Duration
+	ttl          time.Duration
+	maxStale     time.Duration
+	productCount int
+	restored     bool
+}
+
+func (s *ProductService) CacheState() (cacheState, bool) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached == nil {
+		return cacheState{}, false
+	}
+	return cacheState{
+		age:          now.Sub(s.loadedAt),
+		ttl:          s.freshFor,
+		maxStale:     s.maxStale,
+		productCount: len(s.cached.products),
+		restored:     s.cached.restored,
+	}, true
+}
+
+// getSnapshot returns the snapshot to serve: the pinned catalog version when
+// there is one, otherwise the latest. A pinned version never waits for a
+// load; the latest keeps refreshing in the background while it is pinned.
 func (s *ProductService) getSnapshot(ctx context.Context) (*productSnapshot, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	if pinned := s.pinnedLocked(); pinned != nil {
+		if !now.Before(s.expiresAt) {
+			s.refreshInBackgroundLocked(ctx)
+		}
+		s.mu.Unlock()
+		s.recordSnapshotLookup(ctx, snapshotLookupHit)
+		return pinned, nil
+	}
+	s.mu.Unlock()
+	return s.latestSnapshot(ctx)
+}
+
+// latestSnapshot serves the cached snapshot while it is fresh. Once the TTL has
+// passed it keeps serving it and refreshes in the background, until the
+// snapshot is older than maxStale; from then on callers wait for the refresh.
+// A restored snapshot is only a fallback, so it never makes callers wait.
+func (s *ProductService) latestSnapshot(ctx context.Context) (*productSnapshot, error) {
+	outcome := snapshotLookupHit
 	for {
 		now := s.now()
 
@@ -100,109 +405,455 @@ func (s *ProductService) getSnapshot(ctx context.Context) (*productSnapshot, err
 		if now.Before(s.expiresAt) && s.cached != nil {
 			cached := s.cached
 			s.mu.Unlock()
+			s.recordSnapshotLookup(ctx, outcome)
+			return cached, nil
+		}
+
+		if s.cached != nil && (now.Sub(s.loadedAt) < s.maxStale || s.cached.restored) {
+			cached := s.cached
+			s.refreshInBackgroundLocked(ctx)
+			s.mu.Unlock()
+			s.recordSnapshotLookup(ctx, snapshotLookupStale)
 			return cached, nil
 		}
 
+		outcome = snapshotLookupMiss
 		if s.loading {
 			loadDone := s.loadDone
 			s.mu.Unlock()
 
+			_, span := startSpan(ctx, "snapshot.waitLoadDone")
 			select {
 			case <-ctx.Done():
+				endSpan(span, ctx.Err())
 				return nil, ctx.Err()
 			case <-loadDone:
+				span.End()
 				continue
 			}
 		}
 
-		s.loading = true
-		s.loadDone = make(chan struct{})
-		loadDone := s.loadDone
+		loadDone := s.beginLoadLocked()
 		s.mu.Unlock()
 
-		snapshot, err := s.loadSnapshot(context.WithoutCancel(ctx))
-
-		var staleFallback *productSnapshot
-		s.mu.Lock()
+		snapshot, err := s.runLoad(context.WithoutCancel(ctx), loadDone, false)
 		if err == nil {
-			s.cached = snapshot
-			s.expiresAt = s.now().Add(s.ttl)
-		} else if s.cached != nil {
-			staleFallback = s.cached
-			retryAfter := staleRetryWindow
-			if s.ttl > 0 && s.ttl < retryAfter {
-				retryAfter = s.ttl
-			}
-			if retryAfter <= 0 {
-				retryAfter = time.Second
-			}
-			s.expiresAt = s.now().Add(retryAfter)
+			s.recordSnapshotLookup(ctx, snapshotLookupMiss)
+			return snapshot, nil
 		}
-		s.loading = false
-		close(loadDone)
-		s.loadDone = nil
-		if err == nil {
-			cached := s.cached
-			s.mu.Unlock()
-			return cached, nil
+		if snapshot != nil {
+			slog.WarnContext(ctx, "products refresh failed, serving stale cache", "error", err)
+			s.recordSnapshotLookup(ctx, snapshotLookupStale)
+			return snapshot, nil
 		}
-		s.mu.Unlock()
 
-		if staleFallback != nil {
-			log.Printf("products refresh failed, serving stale cache: %v", err)
-			return staleFallback, nil
+		return nil, err
+	}
+}
+
+func (s *ProductService) recordSnapshotLookup(ctx context.Context, outcome string) {
+	s.metrics.recordSnapshotLookup(outcome)
+	setCacheOutcome(ctx, outcome)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("products.cache", outcome))
+}
+
+// refreshInBackgroundLocked starts a load unless one is in flight, while
+// the caller keeps serving what it has.
+func (s *ProductService) refreshInBackgroundLocked(ctx context.Context) {
+	if s.loading {
+		return
+	}
+	loadDone := s.beginLoadLocked()
+	go func() {
+		if _, err := s.runLoad(context.WithoutCancel(ctx), loadDone, false); err != nil {
+			slog.WarnContext(ctx, "background products refresh failed, serving stale cache", "error", err)
 		}
+	}()
+}
 
+func (s *ProductService) beginLoadLocked() chan struct{} {
+	s.loading = true
+	s.loadDone = make(chan struct{})
+	return s.loadDone
+}
+
+// runLoad rebuilds the snapshot and publishes the result. On failure it
+// returns the previous snapshot (if any) with the error and schedules a
+// retry after a short window instead of the full TTL. Every load also picks
+// up the shared catalog pin and records the served prices.
+func (s *ProductService) runLoad(ctx context.Context, loadDone chan struct{}, force bool) (*productSnapshot, error) {
+	s.syncPin(ctx)
+	started := time.Now()
+	loadCtx, span := startSpan(ctx, "loadSnapshot", attribute.Bool("products.load.forced", force))
+	snapshot, err := s.loadSnapshot(loadCtx, force)
+	if err == nil {
+		span.SetAttributes(attribute.Int("products.count", len(snapshot.products)), attribute.String("products.version", snapshot.version))
+	}
+	endSpan(span, err)
+	s.metrics.observeSnapshotLoad(time.Since(started), err)
+	s.recordLoadResult(err)
+	if err == nil {
+		s.saveSnapshot(ctx, snapshot)
+		slog.DebugContext(ctx, "snapshot loaded", "products", len(snapshot.products), "version", snapshot.version, "duration_ms", float64(time.Since(started).Microseconds())/1000)
+	}
+
+	s.mu.Lock()
+	var served *productSnapshot
+	if err == nil {
+		s.recordVersionLocked(snapshot)
+		s.cached = snapshot
+		s.loadedAt = snapshot.builtAt
+		s.expiresAt = snapshot.nextRefresh
+		if s.expiresAt.IsZero() {
+			s.expiresAt = s.loadedAt.Add(s.refreshEvery())
+		}
+		s.freshFor = s.expiresAt.Sub(s.loadedAt)
+		served = s.servedLocked()
+	} else if s.cached != nil {
+		retryAfter := min(staleRetryWindow, s.refreshEvery())
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+		s.expiresAt = s.now().Add(retryAfter)
+	}
+	s.mu.Unlock()
+
+	// Prices only count towards the reference prices once they are served,
+	// so failed loads and versions held back by a pin record nothing.
+	if served != nil {
+		s.recordPrices(ctx, served.products, snapshot.builtAt)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading = false
+	close(loadDone)
+	s.loadDone = nil
+
+	if err != nil {
+		return s.cached, err
+	}
+	return snapshot, nil
+}
+
+// loadSnapshot adopts a fresh snapshot from the shared cache when one exists
+// and otherwise rebuilds from the sources under the cache's rebuild lock.
+// When another replica holds the lock it waits for that replica's result
+// before falling back to a local rebuild. Forced loads skip entries built
+// before they started. Cache failures never fail the load; they only cost
+// the sharing.
+func (s *ProductService) loadSnapshot(ctx context.Context, force bool) (*productSnapshot, error) {
+	requestedAt := time.Time{}
+	if force {
+		requestedAt = s.now()
+	} else if snapshot := s.sharedSnapshot(ctx, requestedAt); snapshot != nil {
+		return snapshot, nil
+	}
+
+	unlock, acquired, err := s.snapshotCache.Lock(ctx, snapshotLockTTL)
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "snapshot cache lock failed, rebuilding without it", "error", err)
+	case !acquired:
+		if snapshot := s.awaitSharedSnapshot(ctx, requestedAt); snapshot != nil {
+			return snapshot, nil
+		}
+		slog.WarnContext(ctx, "snapshot rebuild still locked by another replica, rebuilding locally", "waited", s.lockWait.String())
+	default:
+		defer unlock()
+	}
+
+	snapshot, err := s.buildSnapshotFromSources(ctx, force)
+	if err != nil {
 		return nil, err
 	}
+	if versioner, ok := s.source.(dataVersioner); ok {
+		snapshot.dataVersion = versioner.DataVersion()
+	}
+	snapshot.builtAt = s.now()
+	snapshot.nextRefresh = s.nextSourceDue()
+
+	if err := s.snapshotCache.Store(ctx, newCachedSnapshot(snapshot), s.refreshEvery()); err != nil {
+		slog.WarnContext(ctx, "snapshot cache store failed", "error", err)
+	}
+	return snapshot, nil
 }
 
-func (s *ProductService) loadSnapshot(ctx context.Context) (*productSnapshot, error) {
-	metadata, err := s.source.LoadMetadata(ctx)
+func (s *ProductService) sharedSnapshot(ctx context.Context, notBefore time.Time) *productSnapshot {
+	entry, err := s.snapshotCache.Load(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("load metadata: %w", err)
+		slog.WarnContext(ctx, "snapshot cache load failed", "error", err)
+		return nil
+	}
+	if entry == nil || entry.BuiltAt.Before(notBefore) || !s.now().Before(entry.BuiltAt.Add(s.refreshEvery())) {
+		return nil
+	}
+
+	s.mu.Lock()
+	current := s.cached
+	s.mu.Unlock()
+	if current != nil && current.version == entry.Version {
+		adopted := *current
+		adopted.dataVersion = entry.DataVersion
+		adopted.builtAt = entry.BuiltAt
+		adopted.nextRefresh = time.Time{}
+		adopted.restored = false
+		return &adopted
+	}
+
+	snapshot, err := entry.productSnapshot()
+	if err != nil {
+		slog.WarnContext(ctx, "snapshot cache entry rejected", "error", err)
+		return nil
+	}
+	return snapshot
+}
+
+// recordPrices adds the prices to the history. A failure to persist them
+// only costs durability, so it never fails the load.
+func (s *ProductService) recordPrices(ctx context.Context, products []Product, at time.Time) {
+	if err := s.priceHistory.observe(products, at); err != nil {
+		slog.WarnContext(ctx, "price history update failed", "error", err)
+	}
+}
+
+func (s *ProductService) awaitSharedSnapshot(ctx context.Context, notBefore time.Time) *productSnapshot {
+	deadline := time.NewTimer(s.lockWait)
+	defer deadline.Stop()
+	poll := time.NewTicker(snapshotLockPoll)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline.C:
+			return nil
+		case <-poll.C:
+		}
+		if snapshot := s.sharedSnapshot(ctx, notBefore); snapshot != nil {
+			return snapshot
+		}
 	}
+}
 
-	details, err := s.source.LoadDetails(ctx)
+// buildSnapshotFromSources loads the due sources concurrently and merges
+// them with the last load of the others; forced builds reload every source.
+// Metadata and details are required: the first of them to fail cancels the
+// other loads and aborts the rebuild. Popularity and offers are optional, so
+// their failure only drops ranks or offers from the snapshot.
+func (s *ProductService) buildSnapshotFromSources(ctx context.Context, force bool) (*productSnapshot, error) {
+	loadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg                 sync.WaitGroup
+		now                = s.now()
+		metadata           []MetadataRecord
+		details            []DetailsRecord
+		popularity         []PopularityRecord
+		offers             []OfferRecord
+		metadataErr        error
+		detailsErr         error
+		popErr             error
+		offersErr          error
+		metadataReloaded   bool
+		detailsReloaded    bool
+		popularityReloaded bool
+		offersReloaded     bool
+		hasPopularity      = s.popularitySource != nil
+		hasOffers          = s.offerSource != nil
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if metadata, metadataReloaded, metadataErr = s.sources.metadata.load(loadCtx, ctx, now, force, "LoadMetadata", s.source.LoadMetadata); metadataErr != nil {
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if details, detailsReloaded, detailsErr = s.sources.details.load(loadCtx, ctx, now, force, "LoadDetails", s.source.LoadDetails); detailsErr != nil {
+			cancel()
+		}
+	}()
+	if hasPopularity {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			popularity, popularityReloaded, popErr = s.sources.popularity.load(loadCtx, ctx, now, force, "LoadPopularity", s.popularitySource.LoadPopularity)
+		}()
+	}
+	if hasOffers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			offers, offersReloaded, offersErr = s.sources.offers.load(loadCtx, ctx, now, force, "LoadOffers", s.offerSource.LoadOffers)
+		}()
+	}
+	wg.Wait()
+	slog.DebugContext(ctx, "sources loaded",
+		"metadata_reloaded", metadataReloaded,
+		"details_reloaded", detailsReloaded,
+		"popularity_reloaded", popularityReloaded,
+		"offers_reloaded", offersReloaded,
+	)
+	// Sources that were not due keep the health of their last load. A
+	// required source that failed is always due, so its errors are fresh.
+	if metadataReloaded {
+		s.recordSourceResult(ctx, sourceMetadata, metadataErr)
+	}
+	if detailsReloaded {
+		s.recordSourceResult(ctx, sourceDetails, detailsErr)
+	}
+	// Popularity and offers successes are recorded once their data is known
+	// to be usable.
+	if popErr != nil && popularityReloaded {
+		s.recordSourceResult(ctx, sourcePopularity, popErr)
+	}
+	if offersErr != nil {
+		if offersReloaded {
+			s.recordSourceResult(ctx, sourceOffers, offersErr)
+		}
+		offers = nil
+	}
+
+	// Report the failure that caused the abort, not the cancellation it
+	// triggered in the other required load.
+	if metadataErr != nil && (detailsErr == nil || !canceledBySibling(ctx, metadataErr)) {
+		s.metrics.recordSourceError(sourceMetadata)
+		return nil, fmt.Errorf("load metadata: %w", metadataErr)
+	}
+	if detailsErr != nil {
+		s.metrics.recordSourceError(sourceDetails)
+		return nil, fmt.Errorf("load details: %w", detailsErr)
+	}
+
+	metadata, details, offers, quality, err := s.validateSources(ctx, metadata, details, offers)
 	if err != nil {
-		return nil, fmt.Errorf("load details: %w", err)
+		return nil, fmt.Errorf("validate sources: %w", err)
 	}
 
-	merged, err := mergeProducts(metadata, details)
+	_, mergeSpan := startSpan(ctx, "mergeProducts",
+		attribute.Int("products.metadata_records", len(metadata)),
+		attribute.Int("products.details_records", len(details)),
+	)
+	merged, orphans, err := mergeProducts(metadata, details)
+	mergeSpan.SetAttributes(attribute.Int("products.merged", len(merged)))
+	endSpan(mergeSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("merge products: %w", err)
 	}
 
+	var warnings []string
 	applyPopularityRanks(merged, nil)
-	if s.popularitySource != nil {
-		popularity, popErr := s.popularitySource.LoadPopularity(ctx)
+	// Health, metrics and logs describe loads; a reused outcome was already
+	// reported when it was loaded, and its warning is repeated below.
+	if hasPopularity {
 		if popErr != nil {
-			log.Printf("popularity source load failed, continuing without popularity sort data: %v", popErr)
-			return buildProductSnapshot(merged), nil
+			if popularityReloaded {
+				s.metrics.recordSourceError(sourcePopularity)
+				slog.WarnContext(ctx, "popularity source load failed, continuing without popularity sort data", "error", popErr)
+			}
+			warnings = append(warnings, fmt.Sprintf("load popularity: %v", popErr))
+		} else if rankings, rankErr := normalizePopularityRankings(popularity); rankErr != nil {
+			if popularityReloaded {
+				s.recordSourceResult(ctx, sourcePopularity, fmt.Errorf("invalid data: %w", rankErr))
+				s.metrics.recordSourceError(sourcePopularity)
+				slog.WarnContext(ctx, "popularity source data invalid, continuing without popularity sort data", "error", rankErr)
+			}
+			warnings = append(warnings, fmt.Sprintf("invalid popularity: %v", rankErr))
+		} else {
+			if popularityReloaded {
+				s.recordSourceResult(ctx, sourcePopularity, nil)
+			}
+			orphans.popularity = applyPopularityRanks(merged, rankings)
 		}
-		rankings, rankErr := normalizePopularityRankings(popularity)
-		if rankErr != nil {
-			log.Printf("popularity source data invalid, continuing without popularity sort data: %v", rankErr)
-			return buildProductSnapshot(merged), nil
+	}
+	if hasOffers {
+		if offersErr != nil {
+			if offersReloaded {
+				s.metrics.recordSourceError(sourceOffers)
+				slog.WarnContext(ctx, "offers source load failed, continuing without offers", "error", offersErr)
+			}
+			warnings = append(warnings, fmt.Sprintf("load offers: %v", offersErr))
+		} else if grouped, groupErr := groupOffers(offers); groupErr != nil {
+			if offersReloaded {
+				s.recordSourceResult(ctx, sourceOffers, fmt.Errorf("invalid data: %w", groupErr))
+				s.metrics.recordSourceError(sourceOffers)
+				slog.WarnContext(ctx, "offers source data invalid, continuing without offers", "error", groupErr)
+			}
+			warnings = append(warnings, fmt.Sprintf("invalid offers: %v", groupErr))
+		} else {
+			if offersReloaded {
+				s.recordSourceResult(ctx, sourceOffers, nil)
+			}
+			orphans.offers = applyOffers(merged, basePrices(metadata), grouped, s.bestOfferPolicy)
 		}
-		applyPopularityRanks(merged, rankings)
 	}
+	s.recordOrphans(ctx, orphans)
 
-	return buildProductSnapshot(merged), nil
+	if violations := quality.violationTotal(); violations > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d validation violations, %d records rejected, see /admin/data-quality",
+			violations, quality.RecordsRejected[sourceMetadata]+quality.RecordsRejected[sourceDetails]+quality.RecordsRejected[sourceOffers]))
+	}
+	if orphanCount := len(orphans.metadata) + len(orphans.details) + len(orphans.popularity) + len(orphans.offers); orphanCount > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d orphaned IDs skipped, see /admin/orphans", orphanCount))
+	}
+
+	// Prices are only recorded once the snapshot is published; see runLoad.
+	s.priceHistory.annotate(merged, s.now())
+
+	snapshot := buildProductSnapshot(merged)
+	snapshot.warnings = warnings
+	return snapshot, nil
+}
+
+func canceledBySibling(parent context.Context, err error) bool {
+	return parent.Err() == nil && errors.Is(err, context.Canceled)
+}
+
+func loadSourceTraced[T any](ctx context.Context, name string, load func(context.Context) ([]T, error)) ([]T, error) {
+	ctx, span := startSpan(ctx, name)
+	records, err := load(ctx)
+	span.SetAttributes(attribute.Int("source.records", len(records)))
+	endSpan(span, err)
+	return records, err
 }
 
 func buildProductSnapshot(products []Product) *productSnapshot {
 	availableColors := listAvailableColors(products)
 	availableBrands := listAvailableBrands(products)
 	priceMin, priceMax := listAvailablePriceBounds(products)
+	productIndex := make(map[string]int, len(products))
+	productETags := make([]string, len(products))
+	for i, product := range products {
+		productIndex[product.ID] = i
+		productETags[i] = productETag(product)
+	}
 
 	return &productSnapshot{
+		version:         snapshotContentVersion(productETags),
 		products:        products,
+		productIndex:    productIndex,
+		productETags:    productETags,
 		availableColors: availableColors,
 		availableBrands: availableBrands,
 		priceMin:        priceMin,
 		priceMax:        priceMax,
+		facetUniverse:   buildFacetUniverse(products),
+		searchIndex:     buildSearchIndex(products),
+		suggestIndex:    buildSuggestIndex(products),
+	}
+}
+
+func productETag(product Product) string {
+	encoded, err := json.Marshal(product)
+	if err != nil {
+		encoded = []byte(product.ID)
 	}
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
 }
 
 func cloneStringSlice(values []string) []string {
@@ -246,6 +897,7 @@ func cloneProducts(products []Product) []Product {
 		cloned[i].Colors = cloneStringSlice(products[i].Colors)
 		cloned[i].ImageURLsByColor = cloneStringMap(products[i].ImageURLsByColor)
 		cloned[i].StockByColor = cloneIntMap(products[i].StockByColor)
+		cloned[i].Offers = cloneOffers(products[i].Offers)
 	}
 	return cloned
 }
@@ -260,19 +912,23 @@ func sanitizeQuery(query ProductQuery) ProductQuery {
 	if query.Offset < 0 {
 		query.Offset = 0
 	}
+	query.Cursor = strings.TrimSpace(query.Cursor)
 	query.Search = strings.TrimSpace(query.Search)
 	return query
 }
 
-func mergeProducts(metadata []MetadataRecord, details []DetailsRecord) ([]Product, error) {
+// mergeProducts joins metadata and details by ID. IDs present in only one
+// of the sources are skipped and returned as orphans.
+func mergeProducts(metadata []MetadataRecord, details []DetailsRecord) ([]Product, orphanIDs, error) {
+	var orphans orphanIDs
 	detailsByID := make(map[string]DetailsRecord, len(details))
 	for _, record := range details {
 		id := strings.TrimSpace(record.ID)
 		if id == "" {
-			return nil, fmt.Errorf("details contains empty id")
+			return nil, orphans, fmt.Errorf("details contains empty id")
 		}
 		if _, exists := detailsByID[id]; exists {
-			return nil, fmt.Errorf("details contains duplicate id %q", id)
+			return nil, orphans, fmt.Errorf("details contains duplicate id %q", id)
 		}
 		detailsByID[id] = record
 	}
@@ -283,15 +939,16 @@ func mergeProducts(metadata []MetadataRecord, details []DetailsRecord) ([]Produc
 	for _, meta := range metadata {
 		id := strings.TrimSpace(meta.ID)
 		if id == "" {
-			return nil, fmt.Errorf("metadata contains empty id")
+			return nil, orphans, fmt.Errorf("metadata contains empty id")
 		}
 		if _, exists := seenMetadataIDs[id]; exists {
-			return nil, fmt.Errorf("metadata contains duplicate id %q", id)
+			return nil, orphans, fmt.Errorf("metadata contains duplicate id %q", id)
 		}
 		seenMetadataIDs[id] = struct{}{}
 
 		detail, ok := detailsByID[id]
 		if !ok {
+			orphans.metadata = append(orphans.metadata, id)
 			continue
 		}
 
@@ -323,96 +980,122 @@ func mergeProducts(metadata []MetadataRecord, details []DetailsRecord) ([]Produc
 		})
 	}
 
-	return products, nil
+	for _, id := range sortedKeys(detailsByID) {
+		if _, ok := seenMetadataIDs[id]; !ok {
+			orphans.details = append(orphans.details, id)
+		}
+	}
+	slices.Sort(orphans.metadata)
+
+	return products, orphans, nil
 }
 
-func filterProducts(products []Product, query ProductQuery) []Product {
+func filterProducts(products []Product, filter productFilter) []Product {
 	if len(products) == 0 {
 		return nil
 	}
 
-	search := strings.ToLower(strings.TrimSpace(query.Search))
-	colorFilter := make(map[string]struct{}, len(query.Colors))
-	for _, color := range query.Colors {
-		normalized := normalizeToken(color)
-		if normalized == "" {
-			continue
-		}
-		colorFilter[normalized] = struct{}{}
-	}
-	categoryFilter := make(map[string]struct{}, len(query.Categories))
-	for _, category := range query.Categories {
-		normalized := normalizeToken(category)
-		if normalized == "" {
+	filtered := make([]Product, 0, len(products))
+
+	for _, product := range products {
+		if !filter.matches(product) {
 			continue
 		}
-		categoryFilter[normalized] = struct{}{}
+		product.relevance = filter.searchScores[product.ID]
+		filtered = append(filtered, product)
 	}
-	brandFilter := make(map[string]struct{}, len(query.Brands))
-	for _, brand := range query.Brands {
-		normalized := normalizeToken(brand)
-		if normalized == "" {
-			continue
-		}
-		brandFilter[normalized] = struct{}{}
+
+	return filtered
+}
+
+type productFilter struct {
+	// searchScores is nil when no search is active; otherwise only
+	// products present in it match.
+	searchScores map[string]float64
+	colors       map[string]struct{}
+	categories   map[string]struct{}
+	brands       map[string]struct{}
+	conditions   map[string]struct{}
+	bestseller   *bool
+	inStock      *bool
+	onSale       *bool
+	minPrice     *float64
+	maxPrice     *float64
+	minStock     *int
+}
+
+func newProductFilter(query ProductQuery, searchScores map[string]float64) productFilter {
+	return productFilter{
+		searchScores: searchScores,
+		colors:       normalizedTokenSet(query.Colors),
+		categories:   normalizedTokenSet(query.Categories),
+		brands:       normalizedTokenSet(query.Brands),
+		conditions:   normalizedTokenSet(query.Conditions),
+		bestseller:   query.Bestseller,
+		inStock:      query.InStock,
+		onSale:       query.OnSale,
+		minPrice:     query.MinPrice,
+		maxPrice:     query.MaxPrice,
+		minStock:     query.MinStock,
 	}
-	conditionFilter := make(map[string]struct{}, len(query.Conditions))
-	for _, condition := range query.Conditions {
-		normalized := normalizeToken(condition)
+}
+
+func normalizedTokenSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		normalized := normalizeToken(value)
 		if normalized == "" {
 			continue
 		}
-		conditionFilter[normalized] = struct{}{}
+		set[normalized] = struct{}{}
 	}
+	return set
+}
 
-	filtered := make([]Product, 0, len(products))
-
-	for _, product := range products {
-		if search != "" && !strings.Contains(strings.ToLower(product.Name), search) {
-			continue
-		}
-		if query.Bestseller != nil && product.Bestseller != *query.Bestseller {
-			continue
-		}
-		if query.MinPrice != nil && product.Price < *query.MinPrice {
-			continue
+func (f productFilter) matches(product Product) bool {
+	if f.searchScores != nil {
+		if _, ok := f.searchScores[product.ID]; !ok {
+			return false
 		}
-		if query.MaxPrice != nil && product.Price > *query.MaxPrice {
-			continue
-		}
-		if len(colorFilter) > 0 && !matchesAnyColor(product.Colors, colorFilter) {
-			continue
-		}
-		if len(categoryFilter) > 0 {
-			if _, ok := categoryFilter[normalizeToken(product.Category)]; !ok {
-				continue
-			}
-		}
-		if len(brandFilter) > 0 {
-			if _, ok := brandFilter[normalizeToken(product.Brand)]; !ok {
-				continue
-			}
-		}
-		if len(conditionFilter) > 0 {
-			if _, ok := conditionFilter[normalizeToken(product.Condition)]; !ok {
-				continue
-			}
-		}
-		effectiveStock := effectiveStockForQuery(product, colorFilter)
-		if query.InStock != nil && (effectiveStock > 0) != *query.InStock {
-			continue
+	}
+	if f.bestseller != nil && product.Bestseller != *f.bestseller {
+		return false
+	}
+	if f.minPrice != nil && product.Price < *f.minPrice {
+		return false
+	}
+	if f.maxPrice != nil && product.Price > *f.maxPrice {
+		return false
+	}
+	if len(f.colors) > 0 && !matchesAnyColor(product.Colors, f.colors) {
+		return false
+	}
+	if len(f.categories) > 0 {
+		if _, ok := f.categories[normalizeToken(product.Category)]; !ok {
+			return false
 		}
-		if query.OnSale != nil && (product.DiscountPercent > 0) != *query.OnSale {
-			continue
+	}
+	if len(f.brands) > 0 {
+		if _, ok := f.brands[normalizeToken(product.Brand)]; !ok {
+			return false
 		}
-		if query.MinStock != nil && effectiveStock < *query.MinStock {
-			continue
+	}
+	if len(f.conditions) > 0 {
+		if _, ok := f.conditions[normalizeToken(product.Condition)]; !ok {
+			return false
 		}
-
-		filtered = append(filtered, product)
 	}
-
-	return filtered
+	effectiveStock := effectiveStockForQuery(product, f.colors)
+	if f.inStock != nil && (effectiveStock > 0) != *f.inStock {
+		return false
+	}
+	if f.onSale != nil && (product.DiscountPercent > 0) != *f.onSale {
+		return false
+	}
+	if f.minStock != nil && effectiveStock < *f.minStock {
+		return false
+	}
+	return true
 }
 
 func sortProducts(products []Product, sortMode string) {
@@ -425,10 +1108,16 @@ func sortProducts(products []Product, sortMode string) {
 		return
 	}
 
-	slices.SortStableFunc(products, func(a, b Product) int {
+	slices.SortStableFunc(products, productComparator(sortModes))
+}
+
+func productComparator(sortModes []string) func(a, b Product) int {
+	return func(a, b Product) int {
 		for _, mode := range sortModes {
 			var cmp int
 			switch mode {
+			case SortRelevance:
+				cmp = compareByRelevance(a, b)
 			case SortPopularity:
 				cmp = compareByPopularity(a, b)
 			case SortPriceAsc:
@@ -443,7 +1132,7 @@ func sortProducts(products []Product, sortMode string) {
 			}
 		}
 		return compareByNameThenID(a, b)
-	})
+	}
 }
 
 func popularityRankOrFallback(rank int) int {
@@ -478,6 +1167,16 @@ func parseSortModes(rawSort string) []string {
 	return modes
 }
 
+func compareByRelevance(a, b Product) int {
+	if a.relevance > b.relevance {
+		return -1
+	}
+	if a.relevance < b.relevance {
+		return 1
+	}
+	return 0
+}
+
 func compareByPopularity(a, b Product) int {
 	aRank := popularityRankOrFallback(a.PopularityRank)
 	bRank := popularityRankOrFallback(b.PopularityRank)
@@ -804,8 +1503,12 @@ func normalizePopularityRankings(records []PopularityRecord) (map[string]int, er
 	return rankings, nil
 }
 
-func applyPopularityRanks(products []Product, rankings map[string]int) {
+// applyPopularityRanks sets each product's rank and returns the ranked IDs
+// that match no product, sorted.
+func applyPopularityRanks(products []Product, rankings map[string]int) []string {
+	productIDs := make(map[string]struct{}, len(products))
 	for i := range products {
+		productIDs[products[i].ID] = struct{}{}
 		products[i].PopularityRank = 0
 		if len(rankings) == 0 {
 			continue
@@ -814,6 +1517,14 @@ func applyPopularityRanks(products []Product, rankings map[string]int) {
 			products[i].PopularityRank = rank
 		}
 	}
+
+	var unmatched []string
+	for _, id := range sortedKeys(rankings) {
+		if _, ok := productIDs[id]; !ok {
+			unmatched = append(unmatched, id)
+		}
+	}
+	return unmatched
 }
 
 func isColorInStockForProduct(product Product, color string) bool {
@@ -28,6 +28,11 @@ type fakePopularitySource struct {
 	err     error
 }
 
+type fakeOfferSource struct {
+	records []OfferRecord
+	err     error
+}
+
 func (f *fakeSource) LoadMetadata(_ context.Context) ([]MetadataRecord, error) {
 	f.mu.Lock()
 	start := f.metadataStart
@@ -90,6 +95,13 @@ func (f *fakePopularitySource) LoadPopularity(_ context.Context) ([]PopularityRe
 	return append([]PopularityRecord(nil), f.records...), nil
 }
 
+func (f *fakeOfferSource) LoadOffers(_ context.Context) ([]OfferRecord, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return append([]OfferRecord(nil), f.records...), nil
+}
+
 func TestMergeProducts_BasicAndPriceCalculation(t *testing.T) {
 	metadata := []MetadataRecord{
 		{ID: "p1", Name: "Phone", BasePrice: 1000, ImageURL: "img", Category: " Smartphones ", Brand: " Apple "},
@@ -102,7 +114,7 @@ func TestMergeProducts_BasicAndPriceCalculation(t *testing.T) {
 		{ID: "p999", DiscountPercent: 10, Bestseller: false, Colors: []string{"gray"}},
 	}
 
-	got, err := mergeProducts(metadata, details)
+	got, _, err := mergeProducts(metadata, details)
 	if err != nil {
 		t.Fatalf("mergeProducts() unexpected error: %v", err)
 	}
@@ -161,7 +173,7 @@ func TestMergeProducts_UsesStockByColorWhenProvided(t *testing.T) {
 		},
 	}
 
-	got, err := mergeProducts(metadata, details)
+	got, _, err := mergeProducts(metadata, details)
 	if err != nil {
 		t.Fatalf("mergeProducts() unexpected error: %v", err)
 	}
@@ -204,7 +216,7 @@ func TestMergeProducts_UsesImageURLsByColorWhenProvided(t *testing.T) {
 		},
 	}
 
-	got, err := mergeProducts(metadata, details)
+	got, _, err := mergeProducts(metadata, details)
 	if err != nil {
 		t.Fatalf("mergeProducts() unexpected error: %v", err)
 	}
@@ -228,7 +240,7 @@ func TestMergeProducts_UsesImageURLsByColorWhenProvided(t *testing.T) {
 }
 
 func TestMergeProducts_DuplicateIDs(t *testing.T) {
-	_, err := mergeProducts(
+	_, _, err := mergeProducts(
 		[]MetadataRecord{{ID: "p1"}, {ID: "p1"}},
 		[]DetailsRecord{{ID: "p1"}},
 	)
@@ -236,7 +248,7 @@ func TestMergeProducts_DuplicateIDs(t *testing.T) {
 		t.Fatalf("expected duplicate metadata id error, got %v", err)
 	}
 
-	_, err = mergeProducts(
+	_, _, err = mergeProducts(
 		[]MetadataRecord{{ID: "p1"}},
 		[]DetailsRecord{{ID: "p1"}, {ID: "p1"}},
 	)
@@ -246,7 +258,7 @@ func TestMergeProducts_DuplicateIDs(t *testing.T) {
 }
 
 func TestMergeProducts_EmptyID(t *testing.T) {
-	_, err := mergeProducts(
+	_, _, err := mergeProducts(
 		[]MetadataRecord{{ID: "", Name: "bad"}},
 		[]DetailsRecord{{ID: "p1"}},
 	)
@@ -254,7 +266,7 @@ func TestMergeProducts_EmptyID(t *testing.T) {
 		t.Fatalf("expected empty metadata id error, got %v", err)
 	}
 
-	_, err = mergeProducts(
+	_, _, err = mergeProducts(
 		[]MetadataRecord{{ID: "p1"}},
 		[]DetailsRecord{{ID: ""}},
 	)
@@ -579,6 +591,7 @@ func TestProductService_RefreshesAfterTTL(t *testing.T) {
 	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
 		t.Fatalf("second query unexpected error: %v", err)
 	}
+	waitForBackgroundRefresh(t, service)
 
 	metadataCalls, detailsCalls := source.callCounts()
 	if metadataCalls != 2 || detailsCalls != 2 {
@@ -633,7 +646,7 @@ func TestProductService_AvoidsCacheStampede(t *testing.T) {
 		t.Fatalf("prime query unexpected error: %v", err)
 	}
 
-	now = now.Add(31 * time.Second)
+	now = now.Add(DefaultCacheMaxStaleDuration + time.Second)
 	refreshStarted := make(chan struct{})
 	releaseRefresh := make(chan struct{})
 	source.setMetadataBarrier(refreshStarted, releaseRefresh)
@@ -669,8 +682,10 @@ func TestProductService_AvoidsCacheStampede(t *testing.T) {
 	invokedWG.Wait()
 	close(startWorkers)
 
+	// Details load concurrently with the gated metadata call, so they may or
+	// may not have been fetched yet.
 	metadataCalls, detailsCalls := source.callCounts()
-	if metadataCalls != 2 || detailsCalls != 1 {
+	if metadataCalls != 2 || detailsCalls > 2 {
 		t.Fatalf("expected one refresh in progress before release, metadataCalls=%d detailsCalls=%d", metadataCalls, detailsCalls)
 	}
 	select {
@@ -698,6 +713,108 @@ func TestProductService_AvoidsCacheStampede(t *testing.T) {
 	}
 }
 
+func TestProductService_ServesStaleWhileRevalidating(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", DiscountPercent: 0}},
+	}
+
+	now := time.Date(2026, 2, 24, 19, 0, 0, 0, time.UTC)
+	var nowMu sync.Mutex
+	service := NewProductService(source, 30*time.Second).WithMaxStaleness(5 * time.Minute)
+	service.now = func() time.Time {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		return now
+	}
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("prime query unexpected error: %v", err)
+	}
+
+	source.mu.Lock()
+	source.details[0].DiscountPercent = 50
+	source.mu.Unlock()
+	nowMu.Lock()
+	now = now.Add(31 * time.Second)
+	nowMu.Unlock()
+
+	refreshStarted := make(chan struct{})
+	releaseRefresh := make(chan struct{})
+	source.setMetadataBarrier(refreshStarted, releaseRefresh)
+
+	const workers = 10
+	var wg sync.WaitGroup
+	errCh := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := service.QueryProducts(context.Background(), ProductQuery{})
+			if err == nil && response.Items[0].Price != 100 {
+				err = errors.New("expected stale price while refresh is blocked")
+			}
+			errCh <- err
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			t.Fatalf("stale query unexpected error: %v", err)
+		}
+	}
+
+	<-refreshStarted
+	metadataCalls, _ := source.callCounts()
+	if metadataCalls != 2 {
+		t.Fatalf("expected exactly one background refresh, metadataCalls=%d", metadataCalls)
+	}
+
+	close(releaseRefresh)
+	waitForBackgroundRefresh(t, service)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil {
+		t.Fatalf("query after refresh unexpected error: %v", err)
+	}
+	if response.Items[0].Price != 50 {
+		t.Fatalf("expected refreshed price 50, got %v", response.Items[0].Price)
+	}
+	state, ok := service.CacheState()
+	if !ok || state.age != 0 {
+		t.Fatalf("expected fresh cache state after refresh, got %+v ok=%v", state, ok)
+	}
+}
+
+func TestProductService_BlocksBeyondMaxStaleness(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", DiscountPercent: 0}},
+	}
+
+	now := time.Date(2026, 2, 24, 19, 0, 0, 0, time.UTC)
+	service := NewProductService(source, 30*time.Second).WithMaxStaleness(time.Minute)
+	service.now = func() time.Time { return now }
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("prime query unexpected error: %v", err)
+	}
+
+	source.mu.Lock()
+	source.details[0].DiscountPercent = 50
+	source.mu.Unlock()
+	now = now.Add(61 * time.Second)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil {
+		t.Fatalf("query beyond max staleness unexpected error: %v", err)
+	}
+	if response.Items[0].Price != 50 {
+		t.Fatalf("expected blocking refresh to return fresh price 50, got %v", response.Items[0].Price)
+	}
+}
+
 func TestProductService_WaitingRequestHonorsCancellation(t *testing.T) {
 	started := make(chan struct{})
 	releaseMetadata := make(chan struct{})
@@ -1049,6 +1166,125 @@ func TestProductService_PopularitySourceFailureDoesNotFailQuery(t *testing.T) {
 	}
 }
 
+// rendezvousSource blocks every load until all expected loads have started,
+// so a sequential loader never gets past the first one.
+type rendezvousSource struct {
+	started chan struct{}
+	expect  int
+	failOn  string
+	err     error
+
+	mu       sync.Mutex
+	canceled []string
+}
+
+func (r *rendezvousSource) wait(ctx context.Context, name string) error {
+	r.started <- struct{}{}
+	if name == r.failOn {
+		return r.err
+	}
+	select {
+	case <-ctx.Done():
+		r.mu.Lock()
+		r.canceled = append(r.canceled, name)
+		r.mu.Unlock()
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+		return errors.New(name + " was not canceled")
+	}
+}
+
+func (r *rendezvousSource) LoadMetadata(ctx context.Context) ([]MetadataRecord, error) {
+	return nil, r.wait(ctx, sourceMetadata)
+}
+
+func (r *rendezvousSource) LoadDetails(ctx context.Context) ([]DetailsRecord, error) {
+	return nil, r.wait(ctx, sourceDetails)
+}
+
+func (r *rendezvousSource) LoadPopularity(ctx context.Context) ([]PopularityRecord, error) {
+	return nil, r.wait(ctx, sourcePopularity)
+}
+
+func TestProductService_LoadsSourcesConcurrently(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{}, 3)
+	source := &fakeSource{
+		metadata:     []MetadataRecord{{ID: "p1", Name: "Alpha", BasePrice: 100}},
+		details:      []DetailsRecord{{ID: "p1"}},
+		metadataGate: gate,
+	}
+	popularity := &blockingPopularitySource{started: started, gate: gate, records: []PopularityRecord{{ID: "p1", Rank: 1}}}
+	service := NewProductService(source, 30*time.Second).WithPopularitySource(popularity)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := service.QueryProducts(context.Background(), ProductQuery{})
+		done <- err
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected popularity to load while metadata is still in flight")
+	}
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, detailsCalls := source.callCounts(); detailsCalls == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected details to load while metadata is still in flight")
+		}
+	}
+	close(gate)
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil || response.Items[0].PopularityRank != 1 {
+		t.Fatalf("expected merged popularity rank, got %+v (err=%v)", response.Items, err)
+	}
+}
+
+type blockingPopularitySource struct {
+	started chan struct{}
+	gate    <-chan struct{}
+	records []PopularityRecord
+}
+
+func (b *blockingPopularitySource) LoadPopularity(ctx context.Context) ([]PopularityRecord, error) {
+	b.started <- struct{}{}
+	<-b.gate
+	return b.records, nil
+}
+
+func TestProductService_RequiredSourceFailureCancelsOtherLoads(t *testing.T) {
+	for _, failOn := range []string{sourceMetadata, sourceDetails} {
+		t.Run(failOn, func(t *testing.T) {
+			source := &rendezvousSource{started: make(chan struct{}, 3), failOn: failOn, err: errors.New("upstream down")}
+			metrics := NewMetrics()
+			service := NewProductService(source, 30*time.Second).WithPopularitySource(source).WithMetrics(metrics)
+
+			_, err := service.QueryProducts(context.Background(), ProductQuery{})
+			if err == nil || !strings.Contains(err.Error(), "load "+failOn+": upstream down") {
+				t.Fatalf("expected the %s failure to be reported, got %v", failOn, err)
+			}
+
+			source.mu.Lock()
+			canceled := append([]string(nil), source.canceled...)
+			source.mu.Unlock()
+			if len(canceled) != 2 {
+				t.Fatalf("expected the two other loads to be canceled, got %v", canceled)
+			}
+
+			body := scrapeMetrics(t, metricsHandler(metrics, service))
+			assertMetricLine(t, body, `products_source_errors_total{source="`+failOn+`"} 1`)
+			assertMetricLine(t, body, `products_source_errors_total{source="popularity"} 0`)
+		})
+	}
+}
+
 func TestProductService_PriceBoundsPreservedWhenFilteredResultIsEmpty(t *testing.T) {
 	source := &fakeSource{
 		metadata: []MetadataRecord{
@@ -1176,6 +1412,171 @@ func TestProductService_QueryProductsResponseIsImmutableFromCallerMutations(t *t
 	}
 }
 
+func TestProductService_GetProductUsesSnapshotIndexAndStableETag(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Alpha", BasePrice: 100},
+			{ID: "p2", Name: "Bravo", BasePrice: 200},
+		},
+		details: []DetailsRecord{
+			{ID: "p1", DiscountPercent: 0},
+			{ID: "p2", DiscountPercent: 50},
+		},
+	}
+
+	now := time.Date(2026, 2, 24, 19, 0, 0, 0, time.UTC)
+	service := NewProductService(source, 30*time.Second)
+	service.now = func() time.Time { return now }
+
+	product, firstETag, err := service.GetProduct(context.Background(), "p2")
+	if err != nil {
+		t.Fatalf("GetProduct() unexpected error: %v", err)
+	}
+	if product.ID != "p2" || product.Price != 100 {
+		t.Fatalf("expected p2 with discounted price 100, got %+v", product)
+	}
+
+	_, unchangedETag, err := service.GetProduct(context.Background(), "p2")
+	if err != nil {
+		t.Fatalf("GetProduct() unexpected error: %v", err)
+	}
+	if unchangedETag != firstETag {
+		t.Fatalf("expected stable ETag within snapshot, got %q then %q", firstETag, unchangedETag)
+	}
+
+	source.mu.Lock()
+	source.details[1].DiscountPercent = 10
+	source.mu.Unlock()
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() unexpected error: %v", err)
+	}
+
+	_, changedETag, err := service.GetProduct(context.Background(), "p2")
+	if err != nil {
+		t.Fatalf("GetProduct() after refresh unexpected error: %v", err)
+	}
+	if changedETag == firstETag {
+		t.Fatalf("expected ETag to change when product data changes, got %q", changedETag)
+	}
+
+	if _, _, err := service.GetProduct(context.Background(), "missing"); !errors.Is(err, errProductNotFound) {
+		t.Fatalf("expected errProductNotFound for unknown id, got %v", err)
+	}
+}
+
+func TestProductService_CursorPaginationStableAcrossRefresh(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Alpha", BasePrice: 100},
+			{ID: "p2", Name: "Bravo", BasePrice: 200},
+			{ID: "p3", Name: "Charlie", BasePrice: 300},
+			{ID: "p4", Name: "Delta", BasePrice: 400},
+		},
+		details: []DetailsRecord{
+			{ID: "p1"}, {ID: "p2"}, {ID: "p3"}, {ID: "p4"},
+		},
+	}
+
+	now := time.Date(2026, 2, 24, 19, 0, 0, 0, time.UTC)
+	service := NewProductService(source, 30*time.Second)
+	service.now = func() time.Time { return now }
+
+	first, err := service.QueryProducts(context.Background(), ProductQuery{Sort: SortPriceAsc, Limit: 2})
+	if err != nil {
+		t.Fatalf("first page unexpected error: %v", err)
+	}
+	if first.NextCursor == "" || !first.HasMore {
+		t.Fatalf("expected next_cursor on first page, got %+v", first)
+	}
+
+	source.mu.Lock()
+	source.metadata = append(source.metadata, MetadataRecord{ID: "p0", Name: "Zero", BasePrice: 50})
+	source.details = append(source.details, DetailsRecord{ID: "p0"})
+	source.mu.Unlock()
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() unexpected error: %v", err)
+	}
+
+	second, err := service.QueryProducts(context.Background(), ProductQuery{Sort: SortPriceAsc, Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("second page unexpected error: %v", err)
+	}
+	ids := []string{}
+	for _, item := range second.Items {
+		ids = append(ids, item.ID)
+	}
+	if strings.Join(ids, ",") != "p3,p4" {
+		t.Fatalf("expected cursor page [p3 p4] despite inserted cheaper product, got %v", ids)
+	}
+	if second.Offset != 3 {
+		t.Fatalf("expected resolved offset 3 after refresh, got %d", second.Offset)
+	}
+	if second.HasMore || second.NextCursor != "" {
+		t.Fatalf("expected final page without next_cursor, got has_more=%v next_cursor=%q", second.HasMore, second.NextCursor)
+	}
+}
+
+func TestProductService_CursorWithoutSortResumesAfterLastID(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Alpha", BasePrice: 100},
+			{ID: "p2", Name: "Bravo", BasePrice: 200},
+			{ID: "p3", Name: "Charlie", BasePrice: 300},
+		},
+		details: []DetailsRecord{{ID: "p1"}, {ID: "p2"}, {ID: "p3"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+
+	first, err := service.QueryProducts(context.Background(), ProductQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("first page unexpected error: %v", err)
+	}
+	second, err := service.QueryProducts(context.Background(), ProductQuery{Limit: 1, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("second page unexpected error: %v", err)
+	}
+	if len(second.Items) != 1 || second.Items[0].ID != "p2" {
+		t.Fatalf("expected second page [p2], got %+v", second.Items)
+	}
+}
+
+func TestProductService_CursorRejectedWhenFiltersChange(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "p1", Name: "Alpha", BasePrice: 100, Brand: "apple"},
+			{ID: "p2", Name: "Bravo", BasePrice: 200, Brand: "apple"},
+		},
+		details: []DetailsRecord{{ID: "p1"}, {ID: "p2"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+
+	first, err := service.QueryProducts(context.Background(), ProductQuery{Limit: 1, Brands: []string{"apple"}})
+	if err != nil {
+		t.Fatalf("first page unexpected error: %v", err)
+	}
+
+	_, err = service.QueryProducts(context.Background(), ProductQuery{Limit: 1, Cursor: first.NextCursor})
+	if !errors.Is(err, errInvalidCursor) {
+		t.Fatalf("expected errInvalidCursor when filters change, got %v", err)
+	}
+}
+
+func waitForBackgroundRefresh(t *testing.T, service *ProductService) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		service.mu.Lock()
+		loading := service.loading
+		service.mu.Unlock()
+		if !loading {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("background refresh did not finish in time")
+}
+
 func boolPtr(v bool) *bool {
 	return &v
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const snapshotFormatVersion = 3
+
+type SnapshotCache interface {
+	Load(ctx context.Context) (*cachedSnapshot, error)
+	Store(ctx context.Context, snapshot *cachedSnapshot, ttl time.Duration) error
+	Lock(ctx context.Context, ttl time.Duration) (unlock func(), acquired bool, err error)
+	Delete(ctx context.Context) error
+	// LoadPin returns the catalog version pinned for every replica, or nil
+	// when none is pinned. Delete leaves the pin alone.
+	LoadPin(ctx context.Context) (*cachedSnapshot, error)
+	// StorePin pins snapshot for every replica until it is replaced; nil
+	// unpins.
+	StorePin(ctx context.Context, snapshot *cachedSnapshot) error
+}
+
+type cachedSnapshot struct {
+	Format      int       `json:"format"`
+	Version     string    `json:"version"`
+	DataVersion string    `json:"data_version,omitempty"`
+	BuiltAt     time.Time `json:"built_at"`
+	Products    []Product `json:"products"`
+}
+
+func newCachedSnapshot(snapshot *productSnapshot) *cachedSnapshot {
+	return &cachedSnapshot{
+		Format:      snapshotFormatVersion,
+		Version:     snapshot.version,
+		DataVersion: snapshot.dataVersion,
+		BuiltAt:     snapshot.builtAt,
+		Products:    cloneProducts(snapshot.products),
+	}
+}
+
+// productSnapshot rebuilds the derived indexes. The content version is
+// recomputed and must match, so a truncated or edited entry is rejected.
+func (c *cachedSnapshot) productSnapshot() (*productSnapshot, error) {
+	snapshot := buildProductSnapshot(cloneProducts(c.Products))
+	if snapshot.version != c.Version {
+		return nil, fmt.Errorf("cached snapshot version mismatch: stored %q, content %q", c.Version, snapshot.version)
+	}
+	snapshot.dataVersion = c.DataVersion
+	snapshot.builtAt = c.BuiltAt
+	return snapshot, nil
+}
+
+func snapshotContentVersion(productETags []string) string {
+	hash := sha256.New()
+	for _, etag := range productETags {
+		hash.Write([]byte(etag))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+func encodeCachedSnapshot(snapshot *cachedSnapshot) ([]byte, error) {
+	return json.Marshal(snapshot)
+}
+
+func decodeCachedSnapshot(data []byte) (*cachedSnapshot, error) {
+	var snapshot cachedSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("decode cached snapshot: %w", err)
+	}
+	if snapshot.Format != snapshotFormatVersion {
+		return nil, nil
+	}
+	return &snapshot, nil
+}
+
+type MemorySnapshotCache struct {
+	now func() time.Time
+
+	mu          sync.Mutex
+	snapshot    *cachedSnapshot
+	expiresAt   time.Time
+	lockedUntil time.Time
+	lockToken   uint64
+	pin         *cachedSnapshot
+}
+
+func NewMemorySnapshotCache() *MemorySnapshotCache {
+	return &MemorySnapshotCache{now: time.Now}
+}
+
+func (c *MemorySnapshotCache) Load(_ context.Context) (*cachedSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.snapshot == nil || !c.now().Before(c.expiresAt) {
+		return nil, nil
+	}
+	return c.snapshot, nil
+}
+
+func (c *MemorySnapshotCache) Store(_ context.Context, snapshot *cachedSnapshot, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.snapshot = snapshot
+	c.expiresAt = c.now().Add(ttl)
+	return nil
+}
+
+func (c *MemorySnapshotCache) Delete(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.snapshot = nil
+	c.expiresAt = time.Time{}
+	return nil
+}
+
+func (c *MemorySnapshotCache) LoadPin(_ context.Context) (*cachedSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pin, nil
+}
+
+func (c *MemorySnapshotCache) StorePin(_ context.Context, snapshot *cachedSnapshot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pin = snapshot
+	return nil
+}
+
+func (c *MemorySnapshotCache) Lock(_ context.Context, ttl time.Duration) (func(), bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Before(c.lockedUntil) {
+		return nil, false, nil
+	}
+	c.lockToken++
+	token := c.lockToken
+	c.lockedUntil = now.Add(ttl)
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.lockToken == token {
+			c.lockedUntil = time.Time{}
+		}
+	}, true, nil
+}
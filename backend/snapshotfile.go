@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// snapshotFileFormat versions the envelope of the snapshot file; the
+// snapshot inside carries snapshotFormatVersion like shared cache entries.
+const snapshotFileFormat = 1
+
+// snapshotFileEnvelope is the file layout. Checksum covers the exact bytes
+// of Snapshot, so a torn or edited file is rejected before it is decoded.
+type snapshotFileEnvelope struct {
+	Format   int             `json:"format"`
+	Checksum string          `json:"checksum"`
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// SnapshotFile keeps the last good snapshot on local disk, so a restart
+// while the sources are down still has products to serve.
+type SnapshotFile struct {
+	path string
+
+	mu sync.Mutex
+	// saved is the content version on disk, so rebuilds of unchanged data
+	// skip the write.
+	saved string
+}
+
+func NewSnapshotFile(path string) *SnapshotFile {
+	return &SnapshotFile{path: path}
+}
+
+// Load reads the file. A missing file, or one written in another format,
+// returns nil without an error; a corrupt one returns an error.
+func (f *SnapshotFile) Load() (*cachedSnapshot, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot file: %w", err)
+	}
+
+	var envelope snapshotFileEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("decode snapshot file: %w", err)
+	}
+	if envelope.Format != snapshotFileFormat {
+		return nil, nil
+	}
+	if checksum := snapshotFileChecksum(envelope.Snapshot); checksum != envelope.Checksum {
+		return nil, fmt.Errorf("snapshot file checksum mismatch: stored %q, content %q", envelope.Checksum, checksum)
+	}
+	entry, err := decodeCachedSnapshot(envelope.Snapshot)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.saved = entry.Version
+	f.mu.Unlock()
+	return entry, nil
+}
+
+// Save replaces the file through a temporary file and a rename, so a crash
+// leaves either the previous snapshot or the new one.
+func (f *SnapshotFile) Save(entry *cachedSnapshot) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if entry.Version == f.saved {
+		return nil
+	}
+
+	snapshot, err := encodeCachedSnapshot(entry)
+	if err != nil {
+		return fmt.Errorf("encode snapshot file: %w", err)
+	}
+	data, err := json.Marshal(snapshotFileEnvelope{
+		Format:   snapshotFileFormat,
+		Checksum: snapshotFileChecksum(snapshot),
+		Snapshot: snapshot,
+	})
+	if err != nil {
+		return fmt.Errorf("encode snapshot file: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write snapshot file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("write snapshot file: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return fmt.Errorf("write snapshot file: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("write snapshot file: %w", err)
+	}
+	if err := os.Rename(temp.Name(), f.path); err != nil {
+		return fmt.Errorf("write snapshot file: %w", err)
+	}
+	f.saved = entry.Version
+	return nil
+}
+
+func snapshotFileChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// RestoreSnapshot serves the snapshot saved by an earlier run until the
+// first load from the sources succeeds. It is already past its TTL, so the
+// first request triggers a refresh, and it keeps serving if that fails.
+// Responses from it are marked stale. Without a saved snapshot, or when
+// one is already cached, it does nothing.
+func (s *ProductService) RestoreSnapshot(ctx context.Context) error {
+	if s.snapshotFile == nil {
+		return nil
+	}
+	entry, err := s.snapshotFile.Load()
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		slog.InfoContext(ctx, "no saved snapshot to restore", "path", s.snapshotFile.path)
+		return nil
+	}
+	snapshot, err := entry.productSnapshot()
+	if err != nil {
+		return err
+	}
+	snapshot.restored = true
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached != nil {
+		return nil
+	}
+	s.recordVersionLocked(snapshot)
+	s.cached = snapshot
+	s.loadedAt = snapshot.builtAt
+	s.expiresAt = snapshot.builtAt
+	s.freshFor = 0
+	slog.InfoContext(ctx, "saved snapshot restored", "path", s.snapshotFile.path, "version", snapshot.version, "built_at", snapshot.builtAt, "products", len(snapshot.products))
+	return nil
+}
+
+// saveSnapshot writes a loaded snapshot to the snapshot file. A failure only
+// costs the warm start, so it never fails the load.
+func (s *ProductService) saveSnapshot(ctx context.Context, snapshot *productSnapshot) {
+	if s.snapshotFile == nil {
+		return
+	}
+	if err := s.snapshotFile.Save(newCachedSnapshot(snapshot)); err != nil {
+		slog.WarnContext(ctx, "snapshot file save failed", "path", s.snapshotFile.path, "error", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotFile_RoundTripAndRejectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	file := NewSnapshotFile(path)
+	if entry, err := file.Load(); entry != nil || err != nil {
+		t.Fatalf("expected a missing file to load nothing, got %v / %v", entry, err)
+	}
+
+	snapshot := buildProductSnapshot([]Product{{ID: "p1", Name: "Phone", Price: 90}})
+	snapshot.builtAt = time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC)
+	if err := file.Save(newCachedSnapshot(snapshot)); err != nil {
+		t.Fatalf("save unexpected error: %v", err)
+	}
+	entry, err := NewSnapshotFile(path).Load()
+	if err != nil || entry == nil {
+		t.Fatalf("expected the saved snapshot, got %v / %v", entry, err)
+	}
+	if entry.Version != snapshot.version || !entry.BuiltAt.Equal(snapshot.builtAt) || len(entry.Products) != 1 {
+		t.Fatalf("unexpected snapshot after the round trip: %+v", entry)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Save(newCachedSnapshot(snapshot)); err != nil {
+		t.Fatalf("save unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected an unchanged snapshot to skip the write, got %v", err)
+	}
+
+	changed := buildProductSnapshot([]Product{{ID: "p1", Name: "Phone", Price: 80}})
+	if err := file.Save(newCachedSnapshot(changed)); err != nil {
+		t.Fatalf("save unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"edited": strings.Replace(string(data), `"price":80`, `"price":70`, 1),
+		"torn":   string(data[:len(data)/2]),
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if entry, err := NewSnapshotFile(path).Load(); entry != nil || err == nil {
+			t.Fatalf("expected the %s file to be rejected, got %v / %v", name, entry, err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"format":99,"snapshot":{}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := NewSnapshotFile(path).Load(); entry != nil || err != nil {
+		t.Fatalf("expected another format to be ignored, got %v / %v", entry, err)
+	}
+}
+
+func TestSnapshotFile_WarmStartServesStaleUntilLoaded(t *testing.T) {
+	captureLogOutput(t)
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 2}},
+	}
+	first := NewProductService(source, 30*time.Second).WithSnapshotFile(NewSnapshotFile(path))
+	if err := first.Refresh(context.Background()); err != nil {
+		t.Fatalf("first run refresh unexpected error: %v", err)
+	}
+
+	source.setErr(errors.New("catalog down"))
+	service := NewProductService(source, 30*time.Second).WithSnapshotFile(NewSnapshotFile(path))
+	if err := service.RestoreSnapshot(context.Background()); err != nil {
+		t.Fatalf("restore unexpected error: %v", err)
+	}
+	if err := service.warm(context.Background()); err == nil {
+		t.Fatal("expected warm-up to keep loading past a restored snapshot")
+	}
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{})
+
+	recorder := serveWithEncoding(handler, "/products/p1", "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"name":"Phone"`) {
+		t.Fatalf("expected the restored product while the source is down, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("X-Snapshot-Stale") != "true" || recorder.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("expected restored responses to be marked stale, got %v", recorder.Header())
+	}
+	waitForBackgroundRefresh(t, service)
+	if code, report := fetchReadiness(t, handler); code != http.StatusOK || !report.Snapshot.Restored || !report.Snapshot.Stale {
+		t.Fatalf("expected a ready instance serving a stale restored snapshot, got %d %+v", code, report.Snapshot)
+	}
+
+	source.setErr(nil)
+	if err := service.warm(context.Background()); err != nil {
+		t.Fatalf("warm unexpected error: %v", err)
+	}
+	recorder = serveWithEncoding(handler, "/products/p1", "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("X-Snapshot-Stale") != "" || !strings.HasPrefix(recorder.Header().Get("Cache-Control"), "public") {
+		t.Fatalf("expected a fresh response once the source recovered, got %d %v", recorder.Code, recorder.Header())
+	}
+	if _, report := fetchReadiness(t, handler); report.Snapshot.Restored || report.Snapshot.Stale {
+		t.Fatalf("expected a fresh snapshot, got %+v", report.Snapshot)
+	}
+}
@@ -4,13 +4,14 @@ const (
 	SortPopularity = "popularity"
 	SortPriceAsc   = "price_asc"
 	SortPriceDesc  = "price_desc"
+	SortRelevance  = "relevance"
 )
 
-const sortValidationMessage = "invalid sort: must be one of 'popularity', 'price_asc', 'price_desc'"
+const sortValidationMessage = "invalid sort: must be one of 'popularity', 'price_asc', 'price_desc', 'relevance'"
 
 func isSupportedSortMode(mode string) bool {
 	switch mode {
-	case SortPopularity, SortPriceAsc, SortPriceDesc:
+	case SortPopularity, SortPriceAsc, SortPriceDesc, SortRelevance:
 		return true
 	default:
 		return false
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// sourceState remembers the last load of one source, so a rebuild only
+// reloads the sources whose refresh interval has passed and merges the
+// remembered records of the others.
+type sourceState[T any] struct {
+	name     string
+	interval time.Duration
+	// required sources are reloaded by every rebuild after a failure, since
+	// no rebuild can succeed without them. An optional source keeps its
+	// failure until its interval passes, like it keeps good records.
+	required bool
+
+	mu        sync.Mutex
+	records   []T
+	err       error
+	checkedAt time.Time
+}
+
+func newSourceState[T any](name string, interval time.Duration, required bool) *sourceState[T] {
+	return &sourceState[T]{name: name, interval: interval, required: required}
+}
+
+func (st *sourceState[T]) dueLocked(now time.Time) bool {
+	return st.checkedAt.IsZero() || (st.required && st.err != nil) || !now.Before(st.checkedAt.Add(st.interval))
+}
+
+// load returns the remembered outcome until the source is due, and
+// otherwise loads it. Forced loads always read the source. Loads canceled
+// because a sibling source failed say nothing about this source and are
+// not remembered.
+func (st *sourceState[T]) load(ctx, parent context.Context, now time.Time, force bool, spanName string, load func(context.Context) ([]T, error)) (records []T, reloaded bool, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !force && !st.dueLocked(now) {
+		slog.DebugContext(ctx, "source not due, reusing last load", "source", st.name, "checked_at", st.checkedAt)
+		return slices.Clone(st.records), false, st.err
+	}
+
+	records, err = loadSourceTraced(ctx, spanName, load)
+	if err != nil && canceledBySibling(parent, err) {
+		return nil, true, err
+	}
+	st.checkedAt = now
+	st.err = err
+	if err == nil {
+		st.records = slices.Clone(records)
+	}
+	return records, true, err
+}
+
+// nextDue is when the source should be reloaded next, or the zero time when
+// it was never loaded.
+func (st *sourceState[T]) nextDue() time.Time {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.checkedAt.IsZero() {
+		return time.Time{}
+	}
+	return st.checkedAt.Add(st.interval)
+}
+
+func (st *sourceState[T]) reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.records = nil
+	st.err = nil
+	st.checkedAt = time.Time{}
+}
+
+// sourceStates holds the state of every source the service can load.
+type sourceStates struct {
+	metadata   *sourceState[MetadataRecord]
+	details    *sourceState[DetailsRecord]
+	popularity *sourceState[PopularityRecord]
+	offers     *sourceState[OfferRecord]
+}
+
+func newSourceStates(interval time.Duration) sourceStates {
+	return sourceStates{
+		metadata:   newSourceState[MetadataRecord](sourceMetadata, interval, true),
+		details:    newSourceState[DetailsRecord](sourceDetails, interval, true),
+		popularity: newSourceState[PopularityRecord](sourcePopularity, interval, false),
+		offers:     newSourceState[OfferRecord](sourceOffers, interval, false),
+	}
+}
+
+// WithSourceIntervals sets how often each source is reloaded, by source
+// name. Sources without an entry, or with a zero interval, use the cache
+// TTL. The snapshot is rebuilt whenever any source is due.
+func (s *ProductService) WithSourceIntervals(intervals map[string]time.Duration) *ProductService {
+	for name, interval := range intervals {
+		if interval <= 0 {
+			continue
+		}
+		switch name {
+		case sourceMetadata:
+			s.sources.metadata.interval = interval
+		case sourceDetails:
+			s.sources.details.interval = interval
+		case sourcePopularity:
+			s.sources.popularity.interval = interval
+		case sourceOffers:
+			s.sources.offers.interval = interval
+		}
+	}
+	return s
+}
+
+// refreshEvery is the shortest interval of the configured sources: the
+// longest a snapshot can stay fresh. It bounds shared snapshots, whose
+// source states live on the replica that built them.
+func (s *ProductService) refreshEvery() time.Duration {
+	every := s.sources.metadata.interval
+	every = min(every, s.sources.details.interval)
+	if s.popularitySource != nil {
+		every = min(every, s.sources.popularity.interval)
+	}
+	if s.offerSource != nil {
+		every = min(every, s.sources.offers.interval)
+	}
+	return every
+}
+
+// nextSourceDue is when the first configured source is due again after a
+// local build.
+func (s *ProductService) nextSourceDue() time.Time {
+	due := []time.Time{s.sources.metadata.nextDue(), s.sources.details.nextDue()}
+	if s.popularitySource != nil {
+		due = append(due, s.sources.popularity.nextDue())
+	}
+	if s.offerSource != nil {
+		due = append(due, s.sources.offers.nextDue())
+	}
+	return slices.MinFunc(due, func(a, b time.Time) int { return a.Compare(b) })
+}
+
+func (s *ProductService) resetSources() {
+	s.sources.metadata.reset()
+	s.sources.details.reset()
+	s.sources.popularity.reset()
+	s.sources.offers.reset()
+}
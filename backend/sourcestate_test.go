@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingOfferSource struct {
+	fakeOfferSource
+	calls atomic.Int32
+}
+
+func (c *countingOfferSource) LoadOffers(ctx context.Context) ([]OfferRecord, error) {
+	c.calls.Add(1)
+	return c.fakeOfferSource.LoadOffers(ctx)
+}
+
+func TestSourceIntervals_ReloadsOnlyDueSources(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 3}},
+	}
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	service := NewProductService(source, 10*time.Minute).
+		WithSourceIntervals(map[string]time.Duration{sourceDetails: 5 * time.Second})
+	service.now = func() time.Time { return now }
+
+	if _, _, err := service.GetProduct(context.Background(), "p1"); err != nil {
+		t.Fatalf("first load unexpected error: %v", err)
+	}
+	if state, _ := service.CacheState(); state.ttl != 5*time.Second {
+		t.Fatalf("expected the snapshot to stay fresh until details are due, got %s", state.ttl)
+	}
+
+	source.mu.Lock()
+	source.metadata[0].Name = "Renamed phone"
+	source.details[0].Stock = 1
+	source.mu.Unlock()
+	now = now.Add(6 * time.Second)
+	if _, _, err := service.GetProduct(context.Background(), "p1"); err != nil {
+		t.Fatalf("stale read unexpected error: %v", err)
+	}
+	waitForBackgroundRefresh(t, service)
+
+	product, _, err := service.GetProduct(context.Background(), "p1")
+	if err != nil {
+		t.Fatalf("refreshed read unexpected error: %v", err)
+	}
+	if product.Stock != 1 || product.Name != "Phone" {
+		t.Fatalf("expected new stock merged with the last metadata, got stock=%d name=%q", product.Stock, product.Name)
+	}
+	if metadataCalls, detailsCalls := source.callCounts(); metadataCalls != 1 || detailsCalls != 2 {
+		t.Fatalf("expected only details to reload, metadataCalls=%d detailsCalls=%d", metadataCalls, detailsCalls)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if _, _, err := service.GetProduct(context.Background(), "p1"); err != nil {
+		t.Fatalf("stale read unexpected error: %v", err)
+	}
+	waitForBackgroundRefresh(t, service)
+	if product, _, _ := service.GetProduct(context.Background(), "p1"); product.Name != "Renamed phone" {
+		t.Fatalf("expected metadata to reload once due, got name %q", product.Name)
+	}
+}
+
+func TestSourceIntervals_RefreshReloadsEverySource(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 3}},
+	}
+	offers := &countingOfferSource{}
+	service := NewProductService(source, 10*time.Minute).
+		WithOfferSource(offers, "").
+		WithSourceIntervals(map[string]time.Duration{sourceDetails: 5 * time.Second})
+
+	if _, _, err := service.GetProduct(context.Background(), "p1"); err != nil {
+		t.Fatalf("first load unexpected error: %v", err)
+	}
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+
+	metadataCalls, detailsCalls := source.callCounts()
+	if metadataCalls != 2 || detailsCalls != 2 || offers.calls.Load() != 2 {
+		t.Fatalf("expected a forced refresh to reload every source, metadataCalls=%d detailsCalls=%d offersCalls=%d", metadataCalls, detailsCalls, offers.calls.Load())
+	}
+}
+
+func TestSourceIntervals_OptionalFailureWaitsForInterval(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 3}},
+	}
+	offers := &countingOfferSource{fakeOfferSource: fakeOfferSource{err: errors.New("offers down")}}
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	service := NewProductService(source, time.Minute).
+		WithOfferSource(offers, "").
+		WithSourceIntervals(map[string]time.Duration{sourceDetails: 5 * time.Second})
+	service.now = func() time.Time { return now }
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("first load unexpected error: %v", err)
+	}
+	now = now.Add(6 * time.Second)
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("stale read unexpected error: %v", err)
+	}
+	waitForBackgroundRefresh(t, service)
+
+	if calls := offers.calls.Load(); calls != 1 {
+		t.Fatalf("expected the failed offers load to be reused until due, got %d calls", calls)
+	}
+	if _, detailsCalls := source.callCounts(); detailsCalls != 2 {
+		t.Fatalf("expected details to reload, got %d calls", detailsCalls)
+	}
+	service.mu.Lock()
+	warnings := service.cached.warnings
+	service.mu.Unlock()
+	if len(warnings) == 0 || warnings[0] != "load offers: offers down" {
+		t.Fatalf("expected the reused failure to stay visible as a warning, got %v", warnings)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	suggestKindProduct  = "product"
+	suggestKindBrand    = "brand"
+	suggestKindCategory = "category"
+)
+
+type suggestIndex struct {
+	targets []suggestTarget
+	entries []suggestEntry
+}
+
+type suggestTarget struct {
+	kind      string
+	text      string
+	productID string
+	rank      int
+	// foldedOffsets[i] is the folded byte offset of rune i of text, so
+	// highlights computed on folded keys map back to the displayed text.
+	foldedOffsets []int
+}
+
+type suggestEntry struct {
+	key       string
+	target    int
+	runeStart int
+}
+
+func buildSuggestIndex(products []Product) *suggestIndex {
+	index := &suggestIndex{}
+	brandTargets := make(map[string]int)
+	categoryTargets := make(map[string]int)
+
+	addGrouped := func(groups map[string]int, kind string, value string, rank int) {
+		if value == "" {
+			return
+		}
+		if existing, ok := groups[value]; ok {
+			if rank < index.targets[existing].rank {
+				index.targets[existing].rank = rank
+			}
+			return
+		}
+		groups[value] = index.addTarget(suggestTarget{kind: kind, text: value, rank: rank})
+	}
+
+	for _, product := range products {
+		rank := popularityRankOrFallback(product.PopularityRank)
+		if product.Name != "" {
+			index.addTarget(suggestTarget{kind: suggestKindProduct, text: product.Name, productID: product.ID, rank: rank})
+		}
+		addGrouped(brandTargets, suggestKindBrand, normalizeToken(product.Brand), rank)
+		addGrouped(categoryTargets, suggestKindCategory, normalizeToken(product.Category), rank)
+	}
+
+	slices.SortFunc(index.entries, func(a, b suggestEntry) int {
+		return strings.Compare(a.key, b.key)
+	})
+	return index
+}
+
+func (idx *suggestIndex) addTarget(target suggestTarget) int {
+	runes := []rune(target.text)
+	folded := make([]string, len(runes))
+	target.foldedOffsets = make([]int, len(runes)+1)
+	for i, r := range runes {
+		folded[i] = foldSearchText(string(r))
+		target.foldedOffsets[i+1] = target.foldedOffsets[i] + len(folded[i])
+	}
+	foldedText := strings.Join(folded, "")
+
+	position := len(idx.targets)
+	idx.targets = append(idx.targets, target)
+
+	for i, r := range runes {
+		if !isSearchWordRune(r) || (i > 0 && isSearchWordRune(runes[i-1])) {
+			continue
+		}
+		idx.entries = append(idx.entries, suggestEntry{
+			key:       foldedText[target.foldedOffsets[i]:],
+			target:    position,
+			runeStart: i,
+		})
+	}
+	return position
+}
+
+func isSearchWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (idx *suggestIndex) suggest(rawQuery string, limit int) SuggestionResponse {
+	response := SuggestionResponse{
+		Query:      rawQuery,
+		Products:   []Suggestion{},
+		Brands:     []Suggestion{},
+		Categories: []Suggestion{},
+	}
+
+	prefix := strings.Join(strings.Fields(foldSearchText(rawQuery)), " ")
+	if idx == nil || prefix == "" {
+		return response
+	}
+
+	firstMatch := make(map[int]suggestEntry)
+	start, _ := slices.BinarySearchFunc(idx.entries, prefix, func(entry suggestEntry, target string) int {
+		return strings.Compare(entry.key, target)
+	})
+	for i := start; i < len(idx.entries) && strings.HasPrefix(idx.entries[i].key, prefix); i++ {
+		entry := idx.entries[i]
+		if existing, ok := firstMatch[entry.target]; ok && existing.runeStart <= entry.runeStart {
+			continue
+		}
+		firstMatch[entry.target] = entry
+	}
+
+	matches := make([]suggestEntry, 0, len(firstMatch))
+	for _, entry := range firstMatch {
+		matches = append(matches, entry)
+	}
+	slices.SortFunc(matches, func(a, b suggestEntry) int {
+		targetA, targetB := idx.targets[a.target], idx.targets[b.target]
+		if targetA.rank != targetB.rank {
+			if targetA.rank < targetB.rank {
+				return -1
+			}
+			return 1
+		}
+		if a.runeStart != b.runeStart {
+			return a.runeStart - b.runeStart
+		}
+		if cmp := strings.Compare(strings.ToLower(targetA.text), strings.ToLower(targetB.text)); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(targetA.productID, targetB.productID)
+	})
+
+	for _, entry := range matches {
+		target := idx.targets[entry.target]
+		suggestion := Suggestion{
+			Text:       target.text,
+			ProductID:  target.productID,
+			Highlights: []HighlightRange{target.highlight(entry.runeStart, len(prefix))},
+		}
+		switch target.kind {
+		case suggestKindProduct:
+			if len(response.Products) < limit {
+				response.Products = append(response.Products, suggestion)
+			}
+		case suggestKindBrand:
+			if len(response.Brands) < limit {
+				response.Brands = append(response.Brands, suggestion)
+			}
+		case suggestKindCategory:
+			if len(response.Categories) < limit {
+				response.Categories = append(response.Categories, suggestion)
+			}
+		}
+	}
+
+	return response
+}
+
+func (t suggestTarget) highlight(runeStart int, foldedLength int) HighlightRange {
+	foldedEnd := t.foldedOffsets[runeStart] + foldedLength
+	end := runeStart
+	for end < len(t.foldedOffsets)-1 && t.foldedOffsets[end] < foldedEnd {
+		end++
+	}
+	return HighlightRange{Start: runeStart, End: end}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func suggestionTexts(suggestions []Suggestion) []string {
+	texts := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		texts = append(texts, suggestion.Text)
+	}
+	return texts
+}
+
+func TestSuggestIndex_RanksByPopularityAndGroupsByKind(t *testing.T) {
+	index := buildSuggestIndex([]Product{
+		{ID: "p1", Name: "iPhone 12", Brand: "apple", Category: "smartphones", PopularityRank: 3},
+		{ID: "p2", Name: "iPhone 13", Brand: "apple", Category: "smartphones", PopularityRank: 1},
+		{ID: "p3", Name: "iPad Air", Brand: "apple", Category: "tablets"},
+		{ID: "p4", Name: "Galaxy S21", Brand: "samsung", Category: "smartphones", PopularityRank: 2},
+	})
+
+	response := index.suggest("ip", 5)
+	texts := suggestionTexts(response.Products)
+	if len(texts) != 3 || texts[0] != "iPhone 13" || texts[1] != "iPhone 12" || texts[2] != "iPad Air" {
+		t.Fatalf("expected products ranked by popularity [iPhone 13, iPhone 12, iPad Air], got %v", texts)
+	}
+	if response.Products[0].ProductID != "p2" {
+		t.Fatalf("expected product suggestion to carry product id p2, got %q", response.Products[0].ProductID)
+	}
+
+	response = index.suggest("s", 5)
+	if brands := suggestionTexts(response.Brands); len(brands) != 1 || brands[0] != "samsung" {
+		t.Fatalf("expected brand suggestion [samsung], got %v", brands)
+	}
+	if categories := suggestionTexts(response.Categories); len(categories) != 1 || categories[0] != "smartphones" {
+		t.Fatalf("expected category suggestion [smartphones], got %v", categories)
+	}
+	if products := suggestionTexts(response.Products); len(products) != 1 || products[0] != "Galaxy S21" {
+		t.Fatalf("expected mid-name word match [Galaxy S21], got %v", products)
+	}
+
+	response = index.suggest("ip", 1)
+	if len(response.Products) != 1 {
+		t.Fatalf("expected limit to cap each group, got %d products", len(response.Products))
+	}
+}
+
+func TestSuggestIndex_HighlightsMapToDisplayedText(t *testing.T) {
+	index := buildSuggestIndex([]Product{
+		{ID: "p1", Name: "MacBook Air 13", Brand: "apple"},
+		{ID: "p2", Name: "Straße Café Speaker", Brand: "sonos"},
+	})
+
+	response := index.suggest("air 1", 5)
+	if len(response.Products) != 1 {
+		t.Fatalf("expected one product suggestion, got %v", response.Products)
+	}
+	if got := response.Products[0].Highlights; len(got) != 1 || got[0] != (HighlightRange{Start: 8, End: 13}) {
+		t.Fatalf("expected highlight [8,13) for \"air 1\", got %v", got)
+	}
+
+	response = index.suggest("strasse cafe", 5)
+	if len(response.Products) != 1 {
+		t.Fatalf("expected accent-folded product suggestion, got %v", response.Products)
+	}
+	if got := response.Products[0].Highlights; len(got) != 1 || got[0] != (HighlightRange{Start: 0, End: 11}) {
+		t.Fatalf("expected highlight [0,11) over \"Straße Café\", got %v", got)
+	}
+}
+
+func TestSuggestIndex_NoMatchReturnsEmptyGroups(t *testing.T) {
+	index := buildSuggestIndex([]Product{{ID: "p1", Name: "Phone", Brand: "apple"}})
+
+	response := index.suggest("zzz", 5)
+	if response.Products == nil || response.Brands == nil || response.Categories == nil {
+		t.Fatalf("expected empty non-nil groups, got %+v", response)
+	}
+	if len(response.Products)+len(response.Brands)+len(response.Categories) != 0 {
+		t.Fatalf("expected no suggestions, got %+v", response)
+	}
+}
+
+func TestProductService_SuggestProductsUsesSnapshot(t *testing.T) {
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100, Brand: "apple"}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+
+	response, err := service.SuggestProducts(context.Background(), SuggestQuery{Query: " pho ", Limit: 50})
+	if err != nil {
+		t.Fatalf("SuggestProducts() unexpected error: %v", err)
+	}
+	if len(response.Products) != 1 || response.Products[0].ProductID != "p1" {
+		t.Fatalf("expected suggestion for p1, got %+v", response.Products)
+	}
+}
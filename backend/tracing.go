@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "assignment-backend"
+	defaultServiceName = "assignment-backend"
+
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// setupTracing installs the W3C trace context propagator and, unless the
+// exporter is "none", an SDK tracer provider. The OTLP exporter reads the
+// standard OTEL_EXPORTER_OTLP_* variables for endpoint, headers and
+// protocol settings; OTEL_SERVICE_NAME and OTEL_TRACES_SAMPLER apply too.
+func setupTracing(ctx context.Context, exporterName string, stdout io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(tracePropagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(strings.TrimSpace(exporterName)) {
+	case "", TracingExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case TracingExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q (want none, stdout or otlp)", exporterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", exporterName, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", defaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startSpan resolves the tracer on each call so a provider installed after
+// startup (or swapped in tests) is picked up.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func productQueryAttributes(query ProductQuery) []attribute.KeyValue {
+	filters := len(query.Colors) + len(query.Categories) + len(query.Brands) + len(query.Conditions)
+	for _, set := range []bool{
+		query.Search != "",
+		query.Bestseller != nil,
+		query.InStock != nil,
+		query.OnSale != nil,
+		query.MinPrice != nil,
+		query.MaxPrice != nil,
+		query.MinStock != nil,
+	} {
+		if set {
+			filters++
+		}
+	}
+
+	return []attribute.KeyValue{
+		attribute.Int("products.query.filter_count", filters),
+		attribute.Bool("products.query.search", query.Search != ""),
+		attribute.String("products.query.sort", query.Sort),
+		attribute.Int("products.query.limit", query.Limit),
+		attribute.Bool("products.query.cursor", query.Cursor != ""),
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// withTracing starts a server span per request, continuing the caller's
+// trace when a traceparent header is present. Spans are named after the
+// matched mux pattern to keep span names low-cardinality.
+func withTracing(next http.Handler, routes *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := routePattern(routes, r)
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("url.query", r.URL.RawQuery),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func installSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	original := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(original)
+		_ = provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func spansByName(spans []sdktrace.ReadOnlySpan) map[string]sdktrace.ReadOnlySpan {
+	byName := make(map[string]sdktrace.ReadOnlySpan, len(spans))
+	for _, span := range spans {
+		byName[span.Name()] = span
+	}
+	return byName
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracing_ProductsRequestSpansAndTraceparent(t *testing.T) {
+	captureLogOutput(t)
+	spans := installSpanRecorder(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}, {ID: "p2", Name: "Laptop", BasePrice: 900}},
+		details:  []DetailsRecord{{ID: "p1"}, {ID: "p2"}},
+	}
+	service := NewProductService(source, 30*time.Second).WithPopularitySource(&fakePopularitySource{})
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	request := httptest.NewRequest(http.MethodGet, "/products?search=phone&color=black", nil)
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	byName := spansByName(spans.Ended())
+	for _, name := range []string{
+		"GET /products", "ParseProductQuery", "QueryProducts", "loadSnapshot",
+		"LoadMetadata", "LoadDetails", "LoadPopularity", "mergeProducts", "filterProducts",
+	} {
+		span, ok := byName[name]
+		if !ok {
+			t.Fatalf("expected span %q, got %v", name, byName)
+		}
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Fatalf("expected span %q to continue the incoming trace, got %s", name, span.SpanContext().TraceID())
+		}
+	}
+
+	server := byName["GET /products"]
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected server span parent from traceparent, got %s", server.Parent().SpanID())
+	}
+	if status, _ := spanAttribute(server, "http.response.status_code"); status.AsInt64() != http.StatusOK {
+		t.Fatalf("expected status attribute 200, got %v", status)
+	}
+	if filters, _ := spanAttribute(byName["ParseProductQuery"], "products.query.filter_count"); filters.AsInt64() != 2 {
+		t.Fatalf("expected two active filters, got %v", filters)
+	}
+	query := byName["QueryProducts"]
+	if cache, _ := spanAttribute(query, "products.cache"); cache.AsString() != snapshotLookupMiss {
+		t.Fatalf("expected cache miss attribute, got %v", cache)
+	}
+	if total, ok := spanAttribute(query, "products.total"); !ok || total.AsInt64() != 0 {
+		t.Fatalf("expected total attribute 0 for unmatched color, got %v", total)
+	}
+	if merged, _ := spanAttribute(byName["mergeProducts"], "products.merged"); merged.AsInt64() != 2 {
+		t.Fatalf("expected merged attribute 2, got %v", merged)
+	}
+	if records, _ := spanAttribute(byName["LoadMetadata"], "source.records"); records.AsInt64() != 2 {
+		t.Fatalf("expected metadata record count 2, got %v", records)
+	}
+}
+
+func TestTracing_CacheHitAndSourceErrorsAreRecorded(t *testing.T) {
+	captureLogOutput(t)
+	spans := installSpanRecorder(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var outcomes []string
+	for _, span := range spans.Ended() {
+		if span.Name() == "QueryProducts" {
+			cache, _ := spanAttribute(span, "products.cache")
+			outcomes = append(outcomes, cache.AsString())
+		}
+	}
+	if strings.Join(outcomes, ",") != "miss,hit" {
+		t.Fatalf("expected miss then hit, got %v", outcomes)
+	}
+
+	failing := NewProductService(&fakeSource{err: context.DeadlineExceeded}, 30*time.Second)
+	if _, err := failing.QueryProducts(context.Background(), ProductQuery{}); err == nil {
+		t.Fatal("expected source error")
+	}
+	byName := spansByName(spans.Ended())
+	if byName["LoadMetadata"].Status().Code.String() != "Error" || len(byName["LoadMetadata"].Events()) == 0 {
+		t.Fatalf("expected LoadMetadata span to record the error, got %+v", byName["LoadMetadata"].Status())
+	}
+}
+
+func TestTracing_LogsCarryTraceContext(t *testing.T) {
+	logs := captureLogOutput(t)
+	installSpanRecorder(t)
+	handler := buildServerHandler(NewProductService(&fakeSource{}, 30*time.Second), NewMetrics(), serverConfig{CORSAllowOrigin: "*"})
+
+	request := httptest.NewRequest(http.MethodGet, "/health", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	entry := assertAccessLogged(t, logs, http.MethodGet, "/health")
+	if entry["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || entry["span_id"] == "" {
+		t.Fatalf("expected access log to carry trace context, got %v", entry)
+	}
+}
+
+func TestSetupTracing_ExporterSelection(t *testing.T) {
+	original := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(original) })
+
+	shutdown, err := setupTracing(context.Background(), TracingExporterNone, nil)
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Fatalf("expected no-op tracing, err=%v", err)
+	}
+
+	if _, err := setupTracing(context.Background(), "zipkin", nil); err == nil {
+		t.Fatal("expected unsupported exporter error")
+	}
+
+	var output bytes.Buffer
+	shutdown, err = setupTracing(context.Background(), TracingExporterStdout, &output)
+	if err != nil {
+		t.Fatalf("unexpected stdout exporter error: %v", err)
+	}
+	_, span := startSpan(context.Background(), "stdout-check")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+	if !strings.Contains(output.String(), `"Name":"stdout-check"`) || !strings.Contains(output.String(), defaultServiceName) {
+		t.Fatalf("expected exported span on stdout, got %q", output.String())
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ValidationPolicy string
+
+const (
+	// ValidationRejectRecord drops the offending record from the snapshot.
+	ValidationRejectRecord ValidationPolicy = "reject_record"
+	// ValidationRejectSnapshot fails the whole load; the previous snapshot
+	// keeps serving.
+	ValidationRejectSnapshot ValidationPolicy = "reject_snapshot"
+	// ValidationWarn keeps the record and only reports the violation.
+	ValidationWarn ValidationPolicy = "warn"
+
+	maxReportedViolations = 200
+)
+
+var knownConditions = []string{"new", "refurbished", "used"}
+
+// fieldRule checks one field of a source record. check returns a description
+// of the problem, or "" when the value is acceptable.
+type fieldRule[T any] struct {
+	name   string
+	field  string
+	policy ValidationPolicy
+	check  func(T) string
+}
+
+var metadataRules = []fieldRule[MetadataRecord]{
+	requiredRule(sourceMetadata, "id", ValidationRejectSnapshot, func(r MetadataRecord) string { return r.ID }),
+	requiredRule(sourceMetadata, "name", ValidationRejectRecord, func(r MetadataRecord) string { return r.Name }),
+	rangeRule(sourceMetadata, "base_price", ValidationRejectRecord, 0.01, 1_000_000, func(r MetadataRecord) float64 { return r.BasePrice }),
+	requiredRule(sourceMetadata, "image_url", ValidationWarn, func(r MetadataRecord) string { return r.ImageURL }),
+	urlRule(sourceMetadata, "image_url", ValidationWarn, func(r MetadataRecord) []string { return []string{r.ImageURL} }),
+	requiredRule(sourceMetadata, "category", ValidationWarn, func(r MetadataRecord) string { return r.Category }),
+	requiredRule(sourceMetadata, "brand", ValidationWarn, func(r MetadataRecord) string { return r.Brand }),
+}
+
+var detailsRules = []fieldRule[DetailsRecord]{
+	requiredRule(sourceDetails, "id", ValidationRejectSnapshot, func(r DetailsRecord) string { return r.ID }),
+	rangeRule(sourceDetails, "discount_percent", ValidationRejectRecord, 0, 100, func(r DetailsRecord) int { return r.DiscountPercent }),
+	rangeRule(sourceDetails, "stock", ValidationRejectRecord, 0, math.MaxInt32, func(r DetailsRecord) int { return r.Stock }),
+	{
+		name:   sourceDetails + ".stock_by_color.range",
+		field:  "stock_by_color",
+		policy: ValidationRejectRecord,
+		check: func(r DetailsRecord) string {
+			for _, color := range sortedKeys(r.StockByColor) {
+				if r.StockByColor[color] < 0 {
+					return fmt.Sprintf("stock for color %q must not be negative, got %d", color, r.StockByColor[color])
+				}
+			}
+			return ""
+		},
+	},
+	urlRule(sourceDetails, "image_urls_by_color", ValidationWarn, func(r DetailsRecord) []string {
+		urls := make([]string, 0, len(r.ImageURLsByColor))
+		for _, color := range sortedKeys(r.ImageURLsByColor) {
+			urls = append(urls, r.ImageURLsByColor[color])
+		}
+		return urls
+	}),
+	requiredRule(sourceDetails, "condition", ValidationWarn, func(r DetailsRecord) string { return r.Condition }),
+	{
+		name:   sourceDetails + ".condition.known",
+		field:  "condition",
+		policy: ValidationRejectRecord,
+		check: func(r DetailsRecord) string {
+			condition := normalizeToken(r.Condition)
+			if condition == "" || slices.Contains(knownConditions, condition) {
+				return ""
+			}
+			return fmt.Sprintf("unknown condition %q (want one of %s)", r.Condition, strings.Join(knownConditions, ", "))
+		},
+	},
+}
+
+// offerRules only apply when an offers source is configured. Offers are
+// optional data, so none of them rejects the snapshot by default.
+var offerRules = []fieldRule[OfferRecord]{
+	requiredRule(sourceOffers, "id", ValidationRejectRecord, func(r OfferRecord) string { return r.ID }),
+	requiredRule(sourceOffers, "product_id", ValidationRejectRecord, func(r OfferRecord) string { return r.ProductID }),
+	requiredRule(sourceOffers, "merchant", ValidationWarn, func(r OfferRecord) string { return r.Merchant }),
+	rangeRule(sourceOffers, "price", ValidationRejectRecord, 0.01, 1_000_000, func(r OfferRecord) float64 { return r.Price }),
+	rangeRule(sourceOffers, "stock", ValidationRejectRecord, 0, math.MaxInt32, func(r OfferRecord) int { return r.Stock }),
+	rangeRule(sourceOffers, "warranty_months", ValidationRejectRecord, 0, 120, func(r OfferRecord) int { return r.WarrantyMonths }),
+	{
+		name:   sourceOffers + ".condition.known",
+		field:  "condition",
+		policy: ValidationRejectRecord,
+		check: func(r OfferRecord) string {
+			if slices.Contains(knownConditions, normalizeToken(r.Condition)) {
+				return ""
+			}
+			return fmt.Sprintf("unknown condition %q (want one of %s)", r.Condition, strings.Join(knownConditions, ", "))
+		},
+	},
+}
+
+func requiredRule[T any](source, field string, policy ValidationPolicy, get func(T) string) fieldRule[T] {
+	return fieldRule[T]{
+		name:   source + "." + field + ".required",
+		field:  field,
+		policy: policy,
+		check: func(record T) string {
+			if strings.TrimSpace(get(record)) == "" {
+				return "missing or empty"
+			}
+			return ""
+		},
+	}
+}
+
+func rangeRule[T any, N int | float64](source, field string, policy ValidationPolicy, minValue, maxValue N, get func(T) N) fieldRule[T] {
+	return fieldRule[T]{
+		name:   source + "." + field + ".range",
+		field:  field,
+		policy: policy,
+		check: func(record T) string {
+			if value := get(record); value < minValue || value > maxValue {
+				return fmt.Sprintf("must be between %v and %v, got %v", minValue, maxValue, value)
+			}
+			return ""
+		},
+	}
+}
+
+// urlRule accepts empty values; pair it with requiredRule when the URL must
+// be present.
+func urlRule[T any](source, field string, policy ValidationPolicy, get func(T) []string) fieldRule[T] {
+	return fieldRule[T]{
+		name:   source + "." + field + ".url",
+		field:  field,
+		policy: policy,
+		check: func(record T) string {
+			for _, raw := range get(record) {
+				raw = strings.TrimSpace(raw)
+				if raw == "" {
+					continue
+				}
+				parsed, err := url.Parse(raw)
+				if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+					return fmt.Sprintf("invalid absolute http(s) URL %q", raw)
+				}
+			}
+			return ""
+		},
+	}
+}
+
+func validationRuleNames() []string {
+	names := make([]string, 0, len(metadataRules)+len(detailsRules)+len(offerRules))
+	for _, rule := range metadataRules {
+		names = append(names, rule.name)
+	}
+	for _, rule := range detailsRules {
+		names = append(names, rule.name)
+	}
+	for _, rule := range offerRules {
+		names = append(names, rule.name)
+	}
+	return names
+}
+
+// parseValidationPolicies reads overrides in the form
+// "rule=policy,rule=policy", for example
+// "metadata.image_url.url=reject_record,details.condition.known=warn".
+func parseValidationPolicies(raw string) (map[string]ValidationPolicy, error) {
+	overrides := make(map[string]ValidationPolicy)
+	known := validationRuleNames()
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid validation policy %q (want rule=policy)", entry)
+		}
+		name = strings.TrimSpace(name)
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown validation rule %q", name)
+		}
+		policy := ValidationPolicy(strings.ToLower(strings.TrimSpace(value)))
+		switch policy {
+		case ValidationRejectRecord, ValidationRejectSnapshot, ValidationWarn:
+		default:
+			return nil, fmt.Errorf("invalid policy %q for rule %q (want reject_record, reject_snapshot or warn)", value, name)
+		}
+		overrides[name] = policy
+	}
+	return overrides, nil
+}
+
+// DataQualityReport describes the rule violations found in the most recent
+// load of the metadata, details and offers sources.
+type DataQualityReport struct {
+	CheckedAt        time.Time              `json:"checked_at"`
+	RecordsChecked   map[string]int         `json:"records_checked"`
+	RecordsRejected  map[string]int         `json:"records_rejected"`
+	SnapshotRejected bool                   `json:"snapshot_rejected"`
+	ViolationCounts  map[string]int         `json:"violation_counts"`
+	Violations       []DataQualityViolation `json:"violations"`
+	Truncated        bool                   `json:"truncated"`
+}
+
+type DataQualityViolation struct {
+	Source   string           `json:"source"`
+	Index    int              `json:"index"`
+	RecordID string           `json:"record_id"`
+	Rule     string           `json:"rule"`
+	Field    string           `json:"field"`
+	Policy   ValidationPolicy `json:"policy"`
+	Message  string           `json:"message"`
+}
+
+func newDataQualityReport(checkedAt time.Time) *DataQualityReport {
+	return &DataQualityReport{
+		CheckedAt:       checkedAt,
+		RecordsChecked:  map[string]int{sourceMetadata: 0, sourceDetails: 0, sourceOffers: 0},
+		RecordsRejected: map[string]int{sourceMetadata: 0, sourceDetails: 0, sourceOffers: 0},
+		ViolationCounts: map[string]int{},
+		Violations:      []DataQualityViolation{},
+	}
+}
+
+func (r *DataQualityReport) add(violation DataQualityViolation) {
+	r.ViolationCounts[violation.Rule]++
+	if violation.Policy == ValidationRejectSnapshot {
+		r.SnapshotRejected = true
+	}
+	if len(r.Violations) >= maxReportedViolations {
+		r.Truncated = true
+		return
+	}
+	r.Violations = append(r.Violations, violation)
+}
+
+func (r *DataQualityReport) violationTotal() int {
+	total := 0
+	for _, count := range r.ViolationCounts {
+		total += count
+	}
+	return total
+}
+
+func (r *DataQualityReport) clone() DataQualityReport {
+	cloned := *r
+	cloned.RecordsChecked = maps.Clone(r.RecordsChecked)
+	cloned.RecordsRejected = maps.Clone(r.RecordsRejected)
+	cloned.ViolationCounts = maps.Clone(r.ViolationCounts)
+	cloned.Violations = slices.Clone(r.Violations)
+	return cloned
+}
+
+// snapshotError summarizes the violations that reject the whole snapshot.
+func (r *DataQualityReport) snapshotError() error {
+	if !r.SnapshotRejected {
+		return nil
+	}
+	for _, violation := range r.Violations {
+		if violation.Policy == ValidationRejectSnapshot {
+			return fmt.Errorf("%s record %d (id %q) violates %s: %s", violation.Source, violation.Index, violation.RecordID, violation.Rule, violation.Message)
+		}
+	}
+	return fmt.Errorf("snapshot rejected by validation")
+}
+
+// validateRecords applies rules to every record, records violations in the
+// report and returns the records that no reject_record rule dropped.
+func validateRecords[T any](source string, records []T, id func(T) string, rules []fieldRule[T], overrides map[string]ValidationPolicy, report *DataQualityReport) []T {
+	kept := make([]T, 0, len(records))
+	report.RecordsChecked[source] += len(records)
+	for index, record := range records {
+		rejected := false
+		for _, rule := range rules {
+			message := rule.check(record)
+			if message == "" {
+				continue
+			}
+			policy := rule.policy
+			if override, ok := overrides[rule.name]; ok {
+				policy = override
+			}
+			report.add(DataQualityViolation{
+				Source:   source,
+				Index:    index,
+				RecordID: strings.TrimSpace(id(record)),
+				Rule:     rule.name,
+				Field:    rule.field,
+				Policy:   policy,
+				Message:  message,
+			})
+			if policy == ValidationRejectRecord {
+				rejected = true
+			}
+		}
+		if rejected {
+			report.RecordsRejected[source]++
+			continue
+		}
+		kept = append(kept, record)
+	}
+	return kept
+}
+
+// validateSources checks the loaded records. offers is nil when no offers
+// source is configured or its load failed.
+func (s *ProductService) validateSources(ctx context.Context, metadata []MetadataRecord, details []DetailsRecord, offers []OfferRecord) ([]MetadataRecord, []DetailsRecord, []OfferRecord, *DataQualityReport, error) {
+	report := newDataQualityReport(s.now())
+	metadata = validateRecords(sourceMetadata, metadata, func(r MetadataRecord) string { return r.ID }, metadataRules, s.validationPolicies, report)
+	details = validateRecords(sourceDetails, details, func(r DetailsRecord) string { return r.ID }, detailsRules, s.validationPolicies, report)
+	if offers != nil {
+		offers = validateRecords(sourceOffers, offers, func(r OfferRecord) string { return r.ID }, offerRules, s.validationPolicies, report)
+	}
+
+	s.diagnosticsMu.Lock()
+	s.qualityReport = report
+	s.diagnosticsMu.Unlock()
+
+	for rule, count := range report.ViolationCounts {
+		s.metrics.recordValidationViolations(rule, count)
+	}
+	if len(report.ViolationCounts) > 0 {
+		slog.WarnContext(ctx, "source data quality violations",
+			"violations", report.ViolationCounts,
+			"metadata_rejected", report.RecordsRejected[sourceMetadata],
+			"details_rejected", report.RecordsRejected[sourceDetails],
+			"offers_rejected", report.RecordsRejected[sourceOffers],
+			"snapshot_rejected", report.SnapshotRejected,
+		)
+	}
+	if err := report.snapshotError(); err != nil {
+		return nil, nil, nil, report, err
+	}
+	return metadata, details, offers, report, nil
+}
+
+// DataQualityReport returns the report of the last local load. Snapshots
+// adopted from a shared cache were validated by the replica that built
+// them, so they do not replace it.
+func (s *ProductService) DataQualityReport() (DataQualityReport, bool) {
+	s.diagnosticsMu.Lock()
+	defer s.diagnosticsMu.Unlock()
+	if s.qualityReport == nil {
+		return DataQualityReport{}, false
+	}
+	return s.qualityReport.clone(), true
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProductService_ValidationRejectsAndWarns(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{
+			{ID: "ok", Name: "Phone", BasePrice: 100, ImageURL: "https://img.example/ok.jpg", Category: "phones", Brand: "acme"},
+			{ID: "free", Name: "Freebie", BasePrice: 0, Category: "phones", Brand: "acme"},
+			{ID: "warned", Name: "Tablet", BasePrice: 200, ImageURL: "ftp://img.example/t.jpg", Category: "tablets"},
+			{ID: "bad-stock", Name: "Laptop", BasePrice: 900, Category: "laptops", Brand: "acme"},
+			{ID: "bad-condition", Name: "Watch", BasePrice: 150, Category: "watches", Brand: "acme"},
+		},
+		details: []DetailsRecord{
+			{ID: "ok", Stock: 3, Condition: "new"},
+			{ID: "free", Stock: 1, Condition: "new"},
+			{ID: "warned", StockByColor: map[string]int{"black": 2}, Condition: "used"},
+			{ID: "bad-stock", StockByColor: map[string]int{"black": 2, "white": -1}, Condition: "used"},
+			{ID: "bad-condition", Stock: 5, Condition: "mint"},
+		},
+	}
+	metrics := NewMetrics()
+	service := NewProductService(source, 30*time.Second).WithMetrics(metrics)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, item := range response.Items {
+		ids = append(ids, item.ID)
+	}
+	if strings.Join(ids, ",") != "ok,warned" {
+		t.Fatalf("expected only valid and warned products, got %v", ids)
+	}
+
+	report, ok := service.DataQualityReport()
+	if !ok {
+		t.Fatal("expected a data quality report after the load")
+	}
+	if report.SnapshotRejected || report.RecordsChecked[sourceMetadata] != 5 || report.RecordsRejected[sourceMetadata] != 1 || report.RecordsRejected[sourceDetails] != 2 {
+		t.Fatalf("unexpected report totals: %+v", report)
+	}
+	for rule, want := range map[string]int{
+		"metadata.base_price.range":      1,
+		"metadata.image_url.required":    3,
+		"metadata.image_url.url":         1,
+		"metadata.brand.required":        1,
+		"details.stock_by_color.range":   1,
+		"details.condition.known":        1,
+		"details.discount_percent.range": 0,
+	} {
+		if got := report.ViolationCounts[rule]; got != want {
+			t.Fatalf("expected %d violations of %s, got %d (%v)", want, rule, got, report.ViolationCounts)
+		}
+	}
+
+	var priceViolation DataQualityViolation
+	for _, violation := range report.Violations {
+		if violation.Rule == "metadata.base_price.range" {
+			priceViolation = violation
+		}
+	}
+	if priceViolation.RecordID != "free" || priceViolation.Index != 1 || priceViolation.Field != "base_price" || priceViolation.Policy != ValidationRejectRecord {
+		t.Fatalf("unexpected base price violation: %+v", priceViolation)
+	}
+
+	body := scrapeMetrics(t, metricsHandler(metrics, service))
+	assertMetricLine(t, body, `products_validation_violations_total{rule="details.condition.known"} 1`)
+}
+
+func TestProductService_ValidationRejectSnapshotKeepsPreviousSnapshot(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 1}},
+	}
+	service := NewProductService(source, 30*time.Second)
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	source.mu.Lock()
+	source.metadata = append(source.metadata, MetadataRecord{ID: " ", Name: "Ghost", BasePrice: 10})
+	source.mu.Unlock()
+	err := service.Refresh(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "validate sources: metadata record 1") || !strings.Contains(err.Error(), "metadata.id.required") {
+		t.Fatalf("expected snapshot rejection, got %v", err)
+	}
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil || response.Total != 1 {
+		t.Fatalf("expected previous snapshot to keep serving, got total=%d err=%v", response.Total, err)
+	}
+	if report, _ := service.DataQualityReport(); !report.SnapshotRejected {
+		t.Fatalf("expected report of the rejected load, got %+v", report)
+	}
+}
+
+func TestProductService_ValidationPolicyOverrides(t *testing.T) {
+	captureLogOutput(t)
+	overrides, err := parseValidationPolicies("details.condition.known=warn, metadata.brand.required=REJECT_SNAPSHOT")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Watch", BasePrice: 100, Brand: "acme"}},
+		details:  []DetailsRecord{{ID: "p1", Condition: "mint"}},
+	}
+	service := NewProductService(source, 30*time.Second).WithValidationPolicies(overrides)
+
+	response, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil || response.Total != 1 {
+		t.Fatalf("expected unknown condition to only warn, got total=%d err=%v", response.Total, err)
+	}
+
+	source.mu.Lock()
+	source.metadata[0].Brand = ""
+	source.mu.Unlock()
+	if err := service.Refresh(context.Background()); err == nil || !strings.Contains(err.Error(), "metadata.brand.required") {
+		t.Fatalf("expected missing brand to reject the snapshot, got %v", err)
+	}
+}
+
+func TestDataQualityReport_TruncatesViolations(t *testing.T) {
+	metadata := make([]MetadataRecord, maxReportedViolations+10)
+	for i := range metadata {
+		metadata[i] = MetadataRecord{ID: "p", Name: "Phone", BasePrice: 1, Category: "phones", Brand: "acme"}
+	}
+	report := newDataQualityReport(time.Now())
+	kept := validateRecords(sourceMetadata, metadata, func(r MetadataRecord) string { return r.ID }, metadataRules, nil, report)
+
+	if len(kept) != len(metadata) {
+		t.Fatalf("expected warnings to keep every record, kept %d", len(kept))
+	}
+	if !report.Truncated || len(report.Violations) != maxReportedViolations || report.ViolationCounts["metadata.image_url.required"] != len(metadata) {
+		t.Fatalf("expected truncated list with full counts, got truncated=%v listed=%d counts=%v", report.Truncated, len(report.Violations), report.ViolationCounts)
+	}
+}
+
+func TestParseValidationPolicies_RejectsInvalidEntries(t *testing.T) {
+	if overrides, err := parseValidationPolicies(""); err != nil || len(overrides) != 0 {
+		t.Fatalf("expected no overrides, got %v (err=%v)", overrides, err)
+	}
+	for raw, want := range map[string]string{
+		"details.condition.known":         "want rule=policy",
+		"details.colour.known=warn":       `unknown validation rule "details.colour.known"`,
+		"metadata.name.required=ignore":   `invalid policy "ignore"`,
+		"metadata.name.required=warn,,x=": `unknown validation rule "x"`,
+	} {
+		if _, err := parseValidationPolicies(raw); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q error for %q, got %v", want, raw, err)
+		}
+	}
+}
+
+func TestDataQualityEndpoint(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: -5}},
+		details:  []DetailsRecord{{ID: "p1"}},
+	}
+	service := NewProductService(source, 30*time.Second)
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{CORSAllowOrigin: "*", AdminToken: testAdminToken})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/data-quality"))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before any load, got %d", recorder.Code)
+	}
+
+	if _, err := service.QueryProducts(context.Background(), ProductQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/data-quality"))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	var report DataQualityReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report JSON: %v", err)
+	}
+	if report.RecordsRejected[sourceMetadata] != 1 || report.ViolationCounts["metadata.base_price.range"] != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodPost, "/admin/data-quality"))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", recorder.Code)
+	}
+}
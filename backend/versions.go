@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var errCatalogVersionNotFound = errors.New("catalog version not found")
+
+// catalogVersion is one distinct snapshot content the service has served.
+// Its ID is the content version, so every replica and every run names the
+// same catalog the same way. Loads that reproduce kept content refresh its
+// snapshot and make it the latest again, so the history only grows when the
+// catalog changes.
+type catalogVersion struct {
+	id       string
+	snapshot *productSnapshot
+	// builtAt is when this content was first built.
+	builtAt time.Time
+}
+
+// catalogVersions keeps the last versions, oldest first. A pinned version
+// is served instead of the latest and is never evicted while pinned. The
+// pin is shared through the snapshot cache; see syncPin.
+type catalogVersions struct {
+	limit    int
+	versions []catalogVersion
+	pinned   string
+	// pinChanges counts pins and unpins made here, so a sync that read the
+	// cache before one of them does not undo it.
+	pinChanges int
+}
+
+// CatalogVersion describes one entry of /admin/catalog/versions.
+type CatalogVersion struct {
+	ID           string    `json:"id"`
+	ContentHash  string    `json:"content_hash"`
+	DataVersion  string    `json:"data_version,omitempty"`
+	BuiltAt      time.Time `json:"built_at"`
+	ProductCount int       `json:"product_count"`
+	Latest       bool      `json:"latest"`
+	Pinned       bool      `json:"pinned"`
+}
+
+// CatalogVersionsResponse lists the kept versions, newest first. Serving is
+// the pinned version when there is one and the latest otherwise.
+type CatalogVersionsResponse struct {
+	Serving  string           `json:"serving,omitempty"`
+	Pinned   string           `json:"pinned,omitempty"`
+	Versions []CatalogVersion `json:"versions"`
+}
+
+// WithCatalogVersions sets how many catalog versions are kept for rollback.
+func (s *ProductService) WithCatalogVersions(limit int) *ProductService {
+	if limit > 0 {
+		s.versions.limit = limit
+	}
+	return s
+}
+
+// recordVersionLocked makes the snapshot the latest catalog version,
+// adding a version when its content is not kept yet.
+func (s *ProductService) recordVersionLocked(snapshot *productSnapshot) {
+	history := &s.versions
+	snapshot.catalogVersion = snapshot.version
+	builtAt := snapshot.builtAt
+	if kept := history.indexLocked(snapshot.catalogVersion); kept >= 0 {
+		builtAt = history.versions[kept].builtAt
+		history.versions = slices.Delete(history.versions, kept, kept+1)
+	}
+	history.versions = append(history.versions, catalogVersion{id: snapshot.catalogVersion, snapshot: snapshot, builtAt: builtAt})
+	history.evictLocked()
+}
+
+// adoptPinnedLocked keeps a version pinned on another replica or in an
+// earlier run. Content not kept here goes in just before the latest.
+func (s *ProductService) adoptPinnedLocked(snapshot *productSnapshot) {
+	history := &s.versions
+	snapshot.catalogVersion = snapshot.version
+	if history.indexLocked(snapshot.catalogVersion) < 0 {
+		at := max(len(history.versions)-1, 0)
+		history.versions = slices.Insert(history.versions, at, catalogVersion{id: snapshot.catalogVersion, snapshot: snapshot, builtAt: snapshot.builtAt})
+	}
+	history.pinned = snapshot.catalogVersion
+	history.evictLocked()
+}
+
+func (h *catalogVersions) indexLocked(id string) int {
+	return slices.IndexFunc(h.versions, func(version catalogVersion) bool {
+		return version.id == id
+	})
+}
+
+// evictLocked drops the oldest versions that are neither pinned nor the
+// latest until the limit holds.
+func (h *catalogVersions) evictLocked() {
+	for len(h.versions) > h.limit {
+		evict := slices.IndexFunc(h.versions[:len(h.versions)-1], func(version catalogVersion) bool {
+			return version.id != h.pinned
+		})
+		if evict < 0 {
+			break
+		}
+		h.versions = slices.Delete(h.versions, evict, evict+1)
+	}
+}
+
+// pinnedLocked returns the pinned snapshot, or nil when the latest serves.
+func (s *ProductService) pinnedLocked() *productSnapshot {
+	if s.versions.pinned == "" {
+		return nil
+	}
+	if kept := s.versions.indexLocked(s.versions.pinned); kept >= 0 {
+		return s.versions.versions[kept].snapshot
+	}
+	return nil
+}
+
+// servedLocked is the snapshot requests get: the pinned one, or the cached
+// latest.
+func (s *ProductService) servedLocked() *productSnapshot {
+	if pinned := s.pinnedLocked(); pinned != nil {
+		return pinned
+	}
+	return s.cached
+}
+
+// CatalogVersions lists the kept versions, newest first.
+func (s *ProductService) CatalogVersions() CatalogVersionsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response := CatalogVersionsResponse{Pinned: s.versions.pinned, Versions: []CatalogVersion{}}
+	if served := s.servedLocked(); served != nil {
+		response.Serving = served.catalogVersion
+	}
+	for i := len(s.versions.versions) - 1; i >= 0; i-- {
+		version := s.versions.versions[i]
+		response.Versions = append(response.Versions, CatalogVersion{
+			ID:           version.id,
+			ContentHash:  version.snapshot.version,
+			DataVersion:  version.snapshot.dataVersion,
+			BuiltAt:      version.builtAt,
+			ProductCount: len(version.snapshot.products),
+			Latest:       version.snapshot == s.cached,
+			Pinned:       version.id == s.versions.pinned,
+		})
+	}
+	return response
+}
+
+// PinCatalogVersion serves the version with id instead of the latest until
+// UnpinCatalogVersion. Loads keep running, so the latest stays current
+// while pinned. Pinning an earlier version rolls the catalog back. The pin
+// and its content go to the snapshot cache, so other replicas pick it up
+// on their next load.
+func (s *ProductService) PinCatalogVersion(ctx context.Context, id string) error {
+	s.mu.Lock()
+	kept := s.versions.indexLocked(id)
+	var snapshot *productSnapshot
+	if kept >= 0 {
+		snapshot = s.versions.versions[kept].snapshot
+	}
+	s.mu.Unlock()
+	if snapshot == nil {
+		return errCatalogVersionNotFound
+	}
+
+	if err := s.snapshotCache.StorePin(ctx, newCachedSnapshot(snapshot)); err != nil {
+		return fmt.Errorf("share catalog pin: %w", err)
+	}
+	s.mu.Lock()
+	s.adoptPinnedLocked(snapshot)
+	s.versions.pinChanges++
+	s.mu.Unlock()
+	slog.InfoContext(ctx, "catalog version pinned", "catalog_version", id)
+	return nil
+}
+
+// UnpinCatalogVersion serves the latest version again on every replica.
+func (s *ProductService) UnpinCatalogVersion(ctx context.Context) error {
+	if err := s.snapshotCache.StorePin(ctx, nil); err != nil {
+		return fmt.Errorf("share catalog unpin: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.versions.pinned != "" {
+		slog.InfoContext(ctx, "catalog version unpinned", "catalog_version", s.versions.pinned)
+	}
+	s.versions.pinned = ""
+	s.versions.pinChanges++
+	return nil
+}
+
+// syncPin applies the pin from the snapshot cache, which another replica
+// or an earlier run may have changed. It runs with every load, so a pin
+// reaches every replica within one refresh. A cache failure keeps the
+// local pin.
+func (s *ProductService) syncPin(ctx context.Context) {
+	s.mu.Lock()
+	pinChanges := s.versions.pinChanges
+	s.mu.Unlock()
+
+	entry, err := s.snapshotCache.LoadPin(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "catalog pin load failed, keeping the local pin", "error", err)
+		return
+	}
+	var pinned *productSnapshot
+	if entry != nil {
+		if pinned, err = entry.productSnapshot(); err != nil {
+			slog.WarnContext(ctx, "shared catalog pin rejected, keeping the local pin", "error", err)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.versions.pinChanges != pinChanges:
+		// Pinned or unpinned here meanwhile; the next load syncs again.
+	case pinned == nil && s.versions.pinned != "":
+		slog.InfoContext(ctx, "catalog version unpinned through the snapshot cache", "catalog_version", s.versions.pinned)
+		s.versions.pinned = ""
+	case pinned != nil && pinned.version != s.versions.pinned:
+		s.adoptPinnedLocked(pinned)
+		slog.InfoContext(ctx, "catalog version pinned through the snapshot cache", "catalog_version", pinned.version)
+	}
+}
+
+// CatalogVersion is the ID of the served catalog version, or "" before the
+// first load.
+func (s *ProductService) CatalogVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if served := s.servedLocked(); served != nil {
+		return served.catalogVersion
+	}
+	return ""
+}
+
+func catalogVersionsHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, service.CatalogVersions())
+	})
+}
+
+// catalogPinHandler pins the version named in the path and answers with the
+// updated version list.
+func catalogPinHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		err := service.PinCatalogVersion(r.Context(), strings.TrimSpace(r.PathValue("id")))
+		if errors.Is(err, errCatalogVersionNotFound) {
+			writeError(w, http.StatusNotFound, "catalog version not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "admin catalog pin failed", "error", err)
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, service.CatalogVersions())
+	})
+}
+
+func catalogUnpinHandler(service *ProductService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", http.MethodDelete)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if err := service.UnpinCatalogVersion(r.Context()); err != nil {
+			slog.ErrorContext(r.Context(), "admin catalog unpin failed", "error", err)
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setDetailsStock(source *fakeSource, stock int) {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	source.details[0].Stock = stock
+}
+
+func catalogVersionIDs(response CatalogVersionsResponse) string {
+	ids := make([]string, 0, len(response.Versions))
+	for _, version := range response.Versions {
+		ids = append(ids, version.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestCatalogVersions_KeepsDistinctContentUpToLimit(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 1}},
+	}
+	service := NewProductService(source, 30*time.Second).WithCatalogVersions(2)
+
+	ids := map[int]string{}
+	for _, stock := range []int{1, 1, 2, 3} {
+		setDetailsStock(source, stock)
+		if err := service.Refresh(context.Background()); err != nil {
+			t.Fatalf("refresh unexpected error: %v", err)
+		}
+		ids[stock] = service.CatalogVersion()
+	}
+
+	response := service.CatalogVersions()
+	if got, want := catalogVersionIDs(response), ids[3]+","+ids[2]; got != want || response.Serving != ids[3] || response.Pinned != "" {
+		t.Fatalf("expected %q kept with %q serving, got %q serving %q", want, ids[3], got, response.Serving)
+	}
+	latest, previous := response.Versions[0], response.Versions[1]
+	if !latest.Latest || previous.Latest || latest.ID != latest.ContentHash || latest.ContentHash == previous.ContentHash || latest.ProductCount != 1 || latest.BuiltAt.IsZero() {
+		t.Fatalf("unexpected version entries: %+v", response.Versions)
+	}
+
+	setDetailsStock(source, 2)
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	if response := service.CatalogVersions(); catalogVersionIDs(response) != ids[2]+","+ids[3] || !response.Versions[0].BuiltAt.Equal(previous.BuiltAt) {
+		t.Fatalf("expected reproduced content to become the latest under its first ID, got %+v", response.Versions)
+	}
+
+	other := NewProductService(source, 30*time.Second)
+	if err := other.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	if other.CatalogVersion() != ids[2] {
+		t.Fatalf("expected another instance to name the same content %q, got %q", ids[2], other.CatalogVersion())
+	}
+}
+
+func TestCatalogVersions_PinRollsBackUntilUnpinned(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 1}},
+	}
+	service := NewProductService(source, 30*time.Second).WithCatalogVersions(2)
+	handler := buildServerHandler(service, NewMetrics(), serverConfig{AdminToken: testAdminToken})
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	good := service.CatalogVersion()
+	setDetailsStock(source, 0)
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	bad := service.CatalogVersion()
+
+	recorder := serveWithEncoding(handler, "/products", "")
+	if recorder.Header().Get("X-Catalog-Version") != bad || !strings.Contains(recorder.Body.String(), `"stock":0`) {
+		t.Fatalf("expected the latest version %q, got %q %q", bad, recorder.Header().Get("X-Catalog-Version"), recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodPost, "/admin/catalog/versions/"+good+"/pin"))
+	var pinned CatalogVersionsResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &pinned); err != nil || recorder.Code != http.StatusOK || pinned.Serving != good || pinned.Pinned != good {
+		t.Fatalf("expected %q pinned, got %d %q", good, recorder.Code, recorder.Body.String())
+	}
+	recorder = serveWithEncoding(handler, "/products", "")
+	if recorder.Header().Get("X-Catalog-Version") != good || !strings.Contains(recorder.Body.String(), `"stock":1`) {
+		t.Fatalf("expected the pinned version %q, got %q %q", good, recorder.Header().Get("X-Catalog-Version"), recorder.Body.String())
+	}
+
+	setDetailsStock(source, 5)
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	latest := service.CatalogVersions().Versions[0].ID
+	if response := service.CatalogVersions(); catalogVersionIDs(response) != latest+","+good || response.Serving != good {
+		t.Fatalf("expected loads to continue without evicting the pinned version, got %q serving %q", catalogVersionIDs(response), response.Serving)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, adminRequest(http.MethodDelete, "/admin/catalog/pin"))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 on unpin, got %d", recorder.Code)
+	}
+	if recorder := serveWithEncoding(handler, "/products", ""); recorder.Header().Get("X-Catalog-Version") != latest {
+		t.Fatalf("expected the latest version after unpinning, got %q", recorder.Header().Get("X-Catalog-Version"))
+	}
+
+	for _, check := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/admin/catalog/versions/" + bad + "/pin", http.StatusNotFound},
+		{http.MethodGet, "/admin/catalog/versions/" + latest + "/pin", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/admin/catalog/versions", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/admin/catalog/versions", http.StatusOK},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, adminRequest(check.method, check.path))
+		if recorder.Code != check.want {
+			t.Fatalf("%s %s: expected %d, got %d", check.method, check.path, check.want, recorder.Code)
+		}
+	}
+}
+
+func TestCatalogVersions_PinIsSharedAndSurvivesInvalidation(t *testing.T) {
+	captureLogOutput(t)
+	source := &fakeSource{
+		metadata: []MetadataRecord{{ID: "p1", Name: "Phone", BasePrice: 100}},
+		details:  []DetailsRecord{{ID: "p1", Stock: 1}},
+	}
+	shared := NewMemorySnapshotCache()
+	first := NewProductService(source, 30*time.Second).WithSnapshotCache(shared)
+	if err := first.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	good := first.CatalogVersion()
+	setDetailsStock(source, 0)
+	if err := first.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	if err := first.PinCatalogVersion(context.Background(), good); err != nil {
+		t.Fatalf("pin unexpected error: %v", err)
+	}
+
+	// A replica started after the pin never built the pinned content.
+	second := NewProductService(source, 30*time.Second).WithSnapshotCache(shared)
+	if err := second.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	if response := second.CatalogVersions(); response.Serving != good || response.Pinned != good {
+		t.Fatalf("expected the other replica to serve the shared pin %q, got %+v", good, response)
+	}
+	if product, _, err := second.GetProduct(context.Background(), "p1"); err != nil || product.Stock != 1 {
+		t.Fatalf("expected the pinned product from the other replica, got %+v / %v", product, err)
+	}
+
+	if err := first.Invalidate(context.Background()); err != nil {
+		t.Fatalf("invalidate unexpected error: %v", err)
+	}
+	source.setErr(errors.New("catalog down"))
+	handler := buildServerHandler(first, NewMetrics(), serverConfig{})
+	recorder := serveWithEncoding(handler, "/products/p1", "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("X-Catalog-Version") != good {
+		t.Fatalf("expected the pin to keep serving without waiting for a load, got %d %v", recorder.Code, recorder.Header())
+	}
+	waitForBackgroundRefresh(t, first)
+	source.setErr(nil)
+
+	if err := second.UnpinCatalogVersion(context.Background()); err != nil {
+		t.Fatalf("unpin unexpected error: %v", err)
+	}
+	if err := first.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh unexpected error: %v", err)
+	}
+	if response := first.CatalogVersions(); response.Pinned != "" || response.Serving == good {
+		t.Fatalf("expected the unpin to reach the first replica on its next load, got %+v", response)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+type WatchedFileSource struct {
+	metadata   *watchedFile[MetadataRecord]
+	details    *watchedFile[DetailsRecord]
+	popularity *watchedFile[PopularityRecord]
+	offers     *watchedFile[OfferRecord]
+}
+
+type watchedFile[T any] struct {
+	path string
+
+	mu      sync.Mutex
+	loaded  bool
+	modTime time.Time
+	size    int64
+	hash    string
+	records []T
+
+	rejectedHash string
+}
+
+func NewWatchedFileSource(metadataPath, detailsPath, popularityPath, offersPath string) *WatchedFileSource {
+	return &WatchedFileSource{
+		metadata:   &watchedFile[MetadataRecord]{path: metadataPath},
+		details:    &watchedFile[DetailsRecord]{path: detailsPath},
+		popularity: &watchedFile[PopularityRecord]{path: popularityPath},
+		offers:     &watchedFile[OfferRecord]{path: offersPath},
+	}
+}
+
+func (s *WatchedFileSource) LoadMetadata(ctx context.Context) ([]MetadataRecord, error) {
+	return s.metadata.load(ctx)
+}
+
+func (s *WatchedFileSource) LoadDetails(ctx context.Context) ([]DetailsRecord, error) {
+	return s.details.load(ctx)
+}
+
+func (s *WatchedFileSource) LoadPopularity(ctx context.Context) ([]PopularityRecord, error) {
+	return s.popularity.load(ctx)
+}
+
+func (s *WatchedFileSource) LoadOffers(ctx context.Context) ([]OfferRecord, error) {
+	return s.offers.load(ctx)
+}
+
+func (s *WatchedFileSource) DataVersion() string {
+	metadataHash := s.metadata.contentHash()
+	detailsHash := s.details.contentHash()
+	if metadataHash == "" || detailsHash == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(metadataHash + ":" + detailsHash + ":" + s.popularity.contentHash() + ":" + s.offers.contentHash()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *WatchedFileSource) Watch(ctx context.Context, interval time.Duration, onChange func(context.Context)) {
+	if interval <= 0 {
+		interval = DefaultDataPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		metadataChanged := s.metadata.changed()
+		detailsChanged := s.details.changed()
+		popularityChanged := s.popularity.changed()
+		offersChanged := s.offers.changed()
+		if metadataChanged || detailsChanged || popularityChanged || offersChanged {
+			onChange(ctx)
+		}
+	}
+}
+
+func (f *watchedFile[T]) load(ctx context.Context) ([]T, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", f.path, err)
+	}
+	if f.loaded && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		slog.DebugContext(ctx, "source file unchanged", "path", f.path, "records", len(f.records))
+		return slices.Clone(f.records), nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", f.path, err)
+	}
+	hash := hashContent(data)
+	if f.loaded && hash == f.hash {
+		f.modTime = info.ModTime()
+		f.size = info.Size()
+		return slices.Clone(f.records), nil
+	}
+
+	var records []T
+	if err := json.Unmarshal(data, &records); err != nil {
+		f.rejectedHash = hash
+		return nil, fmt.Errorf("decode %s: %w", f.path, err)
+	}
+
+	f.loaded = true
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.hash = hash
+	f.records = records
+	slog.DebugContext(ctx, "source file loaded", "path", f.path, "records", len(records))
+	return slices.Clone(records), nil
+}
+
+// changed reports whether the file content differs from the last load.
+// A touched file with identical content only refreshes the cached stat, and
+// content that already failed to decode is not reported again.
+func (f *watchedFile[T]) changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false
+	}
+	hash := hashContent(data)
+	if hash == f.hash {
+		f.modTime = info.ModTime()
+		f.size = info.Size()
+		return false
+	}
+	if hash == f.rejectedHash {
+		return false
+	}
+
+	slog.Info("data file changed", "path", f.path)
+	return true
+}
+
+func (f *watchedFile[T]) contentHash() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hash
+}
+
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
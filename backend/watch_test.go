@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type watchedFixture struct {
+	metadataPath   string
+	detailsPath    string
+	popularityPath string
+	offersPath     string
+}
+
+func writeWatchedFixture(t *testing.T) watchedFixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	fixture := watchedFixture{
+		metadataPath:   filepath.Join(dir, "metadata.json"),
+		detailsPath:    filepath.Join(dir, "details.json"),
+		popularityPath: filepath.Join(dir, "popularity.json"),
+		offersPath:     filepath.Join(dir, "offers.json"),
+	}
+	writeFixtureFile(t, fixture.metadataPath, `[{"id":"p1","name":"Phone","base_price":100}]`)
+	writeFixtureFile(t, fixture.detailsPath, `[{"id":"p1","discount_percent":0}]`)
+	writeFixtureFile(t, fixture.popularityPath, `[{"id":"p1","rank":1}]`)
+	writeFixtureFile(t, fixture.offersPath, `[]`)
+	return fixture
+}
+
+func writeFixtureFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write fixture %s: %v", path, err)
+	}
+}
+
+func touchFixtureFile(t *testing.T, path string, offset time.Duration) {
+	t.Helper()
+	modTime := time.Now().Add(offset)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to touch fixture %s: %v", path, err)
+	}
+}
+
+func TestWatchedFileSource_UnchangedContentKeepsVersion(t *testing.T) {
+	fixture := writeWatchedFixture(t)
+	source := NewWatchedFileSource(fixture.metadataPath, fixture.detailsPath, fixture.popularityPath, fixture.offersPath)
+
+	if source.DataVersion() != "" {
+		t.Fatalf("expected empty data version before first load")
+	}
+	if _, err := source.LoadMetadata(context.Background()); err != nil {
+		t.Fatalf("LoadMetadata() unexpected error: %v", err)
+	}
+	if _, err := source.LoadDetails(context.Background()); err != nil {
+		t.Fatalf("LoadDetails() unexpected error: %v", err)
+	}
+	version := source.DataVersion()
+	if version == "" {
+		t.Fatalf("expected data version after load")
+	}
+
+	touchFixtureFile(t, fixture.metadataPath, time.Minute)
+	if source.metadata.changed() {
+		t.Fatalf("expected touched file with identical content to be reported unchanged")
+	}
+
+	metadata, err := source.LoadMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("LoadMetadata() after touch unexpected error: %v", err)
+	}
+	if len(metadata) != 1 || metadata[0].Name != "Phone" {
+		t.Fatalf("expected cached metadata after touch, got %+v", metadata)
+	}
+	if got := source.DataVersion(); got != version {
+		t.Fatalf("expected data version %q to stay stable, got %q", version, got)
+	}
+}
+
+func TestWatchedFileSource_DetectsContentChangesAndSkipsRejectedContent(t *testing.T) {
+	fixture := writeWatchedFixture(t)
+	source := NewWatchedFileSource(fixture.metadataPath, fixture.detailsPath, fixture.popularityPath, fixture.offersPath)
+
+	if _, err := source.LoadDetails(context.Background()); err != nil {
+		t.Fatalf("LoadDetails() unexpected error: %v", err)
+	}
+
+	writeFixtureFile(t, fixture.detailsPath, `[{"id":"p1","discount_percent":25}]`)
+	touchFixtureFile(t, fixture.detailsPath, time.Minute)
+	if !source.details.changed() {
+		t.Fatalf("expected changed content to be detected")
+	}
+	details, err := source.LoadDetails(context.Background())
+	if err != nil {
+		t.Fatalf("LoadDetails() after change unexpected error: %v", err)
+	}
+	if details[0].DiscountPercent != 25 {
+		t.Fatalf("expected reparsed discount 25, got %d", details[0].DiscountPercent)
+	}
+
+	writeFixtureFile(t, fixture.detailsPath, `{not-json`)
+	touchFixtureFile(t, fixture.detailsPath, 2*time.Minute)
+	if !source.details.changed() {
+		t.Fatalf("expected malformed content to be reported once")
+	}
+	if _, err := source.LoadDetails(context.Background()); err == nil {
+		t.Fatalf("expected decode error for malformed content")
+	}
+	if source.details.changed() {
+		t.Fatalf("expected already rejected content not to be reported again")
+	}
+}
+
+func TestWatchedFileSource_WatchRefreshesServiceOnChange(t *testing.T) {
+	fixture := writeWatchedFixture(t)
+	source := NewWatchedFileSource(fixture.metadataPath, fixture.detailsPath, fixture.popularityPath, fixture.offersPath)
+	service := NewProductService(source, time.Hour).WithPopularitySource(source)
+
+	first, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil {
+		t.Fatalf("prime query unexpected error: %v", err)
+	}
+	if first.Items[0].Price != 100 {
+		t.Fatalf("expected initial price 100, got %v", first.Items[0].Price)
+	}
+	firstVersion := service.DataVersion()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan struct{}, 1)
+	go source.Watch(ctx, 10*time.Millisecond, func(ctx context.Context) {
+		if err := service.Refresh(ctx); err != nil {
+			t.Errorf("Refresh() unexpected error: %v", err)
+		}
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+
+	writeFixtureFile(t, fixture.metadataPath, `[{"id":"p1","name":"Phone","base_price":150}]`)
+	touchFixtureFile(t, fixture.metadataPath, time.Minute)
+
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected watcher to trigger a reload")
+	}
+
+	second, err := service.QueryProducts(context.Background(), ProductQuery{})
+	if err != nil {
+		t.Fatalf("query after reload unexpected error: %v", err)
+	}
+	if second.Items[0].Price != 150 {
+		t.Fatalf("expected reloaded price 150 before TTL expiry, got %v", second.Items[0].Price)
+	}
+	if service.DataVersion() == firstVersion {
+		t.Fatalf("expected data version to change after reload")
+	}
+
+	recorder := httptest.NewRecorder()
+	NewProductHandler(service).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/products", nil))
+	if got := recorder.Header().Get("X-Data-Version"); got != service.DataVersion() {
+		t.Fatalf("expected X-Data-Version %q, got %q", service.DataVersion(), got)
+	}
+}